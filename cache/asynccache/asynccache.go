@@ -15,65 +15,257 @@
 package asynccache
 
 import (
-	"fmt"
+	"context"
+	"io"
 	"log"
+	"math"
 	"sync"
 	"sync/atomic"
 	"time"
-
-	sf "golang.org/x/sync/singleflight"
 )
 
-// Options controls the behavior of AsyncCache.
-type Options struct {
+// TypedOptions controls the behavior of TypedAsyncCache.
+type TypedOptions[K comparable, V any] struct {
 	RefreshDuration time.Duration
-	Fetcher         func(key string) (interface{}, error)
+	Fetcher         func(key K) (V, error)
+
+	// HintFetcher is used instead of Fetcher if set,
+	// it allows to return per-entry refresh and expire durations.
+	HintFetcher func(key K) (V, FetchHint, error)
+	// CtxFetcher is used instead of Fetcher and HintFetcher if set.
+	// The context of a fetch triggered by GetCtx keeps the values of the caller's context,
+	// and the context of all the fetches is bounded by FetchTimeout.
+	CtxFetcher   func(ctx context.Context, key K) (V, error)
+	FetchTimeout time.Duration
+
+	// BatchFetcher fetches multiple keys at once, the keys missing in both of the
+	// returned maps get ErrNotFetched. If set, it is used by refreshing in chunks of
+	// BatchSize, and by MGet to fetch the missing keys.
+	// Fetcher and HintFetcher are optional if BatchFetcher is set.
+	BatchFetcher func(keys []K) (map[K]V, map[K]error)
+	// BatchSize is the max number of keys passed to BatchFetcher when refreshing,
+	// defaults to 100.
+	BatchSize int
+
+	// RefreshTick is the granularity of refreshing, defaults to RefreshDuration.
+	// It should be set to the shortest refresh duration returned by HintFetcher.
+	RefreshTick time.Duration
+
+	// RefreshConcurrency is the number of goroutines fetching in a refresh cycle, defaults to 1.
+	RefreshConcurrency int
+	// RefreshRateLimit limits the fetches per second in a refresh cycle, 0 means no limit.
+	RefreshRateLimit int
+	// RefreshJitter spreads the fetches of a refresh cycle randomly over
+	// RefreshJitter*RefreshTick to avoid bursts, it must be in [0, 1).
+	RefreshJitter float64
+	// RefreshCycleHandler is called with the duration of each refresh cycle,
+	// overrun is true if the cycle took longer than RefreshTick and delayed the next one.
+	RefreshCycleHandler func(duration time.Duration, overrun bool)
+
+	// MaxStaleness drops an entry whose refreshing keeps failing for longer than it,
+	// instead of serving the stale value forever. 0 means no limit.
+	MaxStaleness time.Duration
+	// NegativeTTL is how long the error of a failed first-time fetch is cached.
+	// After that, a get fetches the key again, and the TTL is doubled on each
+	// consecutive failure up to MaxNegativeTTL (defaults to 16 * NegativeTTL).
+	// 0 means the error is cached until a refresh succeeds.
+	NegativeTTL    time.Duration
+	MaxNegativeTTL time.Duration
+
+	// SnapshotCodec is used by Snapshot and Restore, defaults to GobCodec.
+	SnapshotCodec Codec
+
+	// L2Store is consulted before fetching if set, and the fetched values are
+	// written through to it with L2TTL. The errors of L2Store are logged by ErrLogFunc.
+	// The refreshes consult the L2Store too, so L2TTL must be positive for the
+	// source to be fetched again, it bounds the staleness of the L2Store.
+	L2Store L2Store[K, V]
+	L2TTL   time.Duration
+
+	// NewStorage creates the storage of the entries, defaults to NewSyncMapStorage.
+	// NewShardedStorage performs better for write-heavy caches.
+	NewStorage func() Storage[K]
+
+	// StatsReporter is notified of the events counted by Stats if set,
+	// e.g. to export them to a metrics system.
+	StatsReporter StatsReporter
 
 	// If EnableExpire is true, ExpireDuration MUST be set.
 	EnableExpire   bool
 	ExpireDuration time.Duration
 
-	ErrorHandler  func(key string, err error)
-	ChangeHandler func(key string, oldData, newData interface{})
-	DeleteHandler func(key string, oldData interface{})
+	ErrorHandler  func(key K, err error)
+	ChangeHandler func(key K, oldData, newData V)
+	DeleteHandler func(key K, oldData V)
 
-	IsSame     func(key string, oldData, newData interface{}) bool
+	IsSame     func(key K, oldData, newData V) bool
 	ErrLogFunc func(str string)
+
+	// MaxEntries limits the number of cached entries, 0 means no limit.
+	// Entries are evicted by the eviction policy when the limit is exceeded,
+	// and DeleteHandler is called for each of them.
+	MaxEntries int
+	// MaxBytes limits the total size of cached values, 0 means no limit.
+	// If MaxBytes is set, Sizer MUST be set to measure the size of a value.
+	MaxBytes int64
+	Sizer    func(key K, val V) int64
+	// NewEvictionPolicy creates the eviction policy of a bounded cache.
+	// Defaults to NewLRUPolicy.
+	NewEvictionPolicy func() EvictionPolicy[K]
 }
 
-// AsyncCache .
-type AsyncCache interface {
+// TypedAsyncCache is a type-safe cache which fetches and updates the latest data periodically.
+type TypedAsyncCache[K comparable, V any] interface {
 	// SetDefault sets the default value of given key if it is new to the cache.
 	// It is useful for cache warming up.
-	// Param val should not be nil.
-	SetDefault(key string, val interface{}) (exist bool)
+	SetDefault(key K, val V) (exist bool)
 
 	// Get tries to fetch a value corresponding to the given key from the cache.
 	// If error occurs during the first time fetching, it will be cached until the
 	// sequential fetching triggered by the refresh goroutine succeed.
-	Get(key string) (val interface{}, err error)
+	// ErrClosed is returned after closing.
+	Get(key K) (val V, err error)
 
 	// GetOrSet tries to fetch a value corresponding to the given key from the cache.
 	// If the key is not yet cached or error occurs, the default value will be set.
-	GetOrSet(key string, defaultVal interface{}) (val interface{})
+	// After closing, the default value is returned for the keys not cached, without setting.
+	GetOrSet(key K, defaultVal V) (val V)
 
 	// Dump dumps all cache entries.
 	// This will not cause expire to refresh.
-	Dump() map[string]interface{}
+	Dump() map[K]V
 
 	// DeleteIf deletes cached entries that match the `shouldDelete` predicate.
-	DeleteIf(shouldDelete func(key string) bool)
+	DeleteIf(shouldDelete func(key K) bool)
 
 	// Close closes the async cache.
 	// This should be called when the cache is no longer needed, or may lead to resource leak.
 	Close()
 }
 
-// asyncCache .
-type asyncCache struct {
-	sfg  sf.Group
-	opt  Options
-	data sync.Map
+// The interfaces below are optional, they are implemented by the caches created by
+// NewAsyncCache and NewTypedAsyncCache, and found by type assertion, e.g.
+//
+//	if g, ok := c.(asynccache.CtxGetter[string, interface{}]); ok {
+//		v, err = g.GetCtx(ctx, key)
+//	}
+//
+// Invalidator is one of them too.
+
+// CtxGetter gets values with a context.
+type CtxGetter[K comparable, V any] interface {
+	// GetCtx is like Get, but returns ctx.Err() once ctx is done while fetching.
+	// The fetch keeps running for other callers and later gets.
+	GetCtx(ctx context.Context, key K) (val V, err error)
+}
+
+// MetaGetter gets values with their metadata.
+type MetaGetter[K comparable, V any] interface {
+	// GetWithMeta is like Get, and returns the metadata of the entry,
+	// which tells whether the value is stale.
+	GetWithMeta(key K) (val V, meta EntryMeta, err error)
+}
+
+// BatchGetter gets the values of several keys at once.
+type BatchGetter[K comparable, V any] interface {
+	// MGet gets the values of keys like Get, but the missing keys are fetched
+	// by a single BatchFetcher call. Keys failed to fetch are returned in errs.
+	MGet(keys ...K) (vals map[K]V, errs map[K]error)
+}
+
+// Refresher fetches keys on demand.
+type Refresher[K comparable, V any] interface {
+	// Refresh fetches key immediately, bypassing the L2Store, and returns the fetched value.
+	// The concurrent refreshes of key are deduplicated, they don't share the fetches of gets.
+	Refresh(key K) (val V, err error)
+}
+
+// StatsProvider reports the statistics of a cache.
+type StatsProvider interface {
+	// Stats returns the statistics of the cache.
+	Stats() Stats
+}
+
+// Snapshotter saves and restores the values of a cache.
+type Snapshotter interface {
+	// Snapshot writes the cached values to w, which can be restored by Restore,
+	// e.g. to warm up the cache after restarting.
+	Snapshot(w io.Writer) error
+
+	// Restore reads a snapshot from r and sets the values of the keys not cached yet.
+	// The restored values are served as stale and refreshed in the background.
+	Restore(r io.Reader) error
+}
+
+// CtxCloser closes a cache gracefully.
+type CtxCloser interface {
+	// CloseCtx closes the async cache like Close, and waits for the in-flight refreshes
+	// and handler callbacks until ctx is done, in which case ctx.Err() is returned.
+	CloseCtx(ctx context.Context) error
+}
+
+// FetchHint customizes the behavior of a single entry.
+// Zero values fall back to the options of the cache.
+type FetchHint struct {
+	// Refresh is the refresh duration of the entry,
+	// it is rounded up to a multiple of RefreshTick.
+	Refresh time.Duration
+	// Expire is the duration after which the entry expires if unused,
+	// it is rounded up to a multiple of ExpireDuration and takes effect only if EnableExpire is true.
+	Expire time.Duration
+}
+
+// Options controls the behavior of AsyncCache.
+// It is kept for compatibility, TypedOptions is preferred in new code.
+type Options = TypedOptions[string, interface{}]
+
+// AsyncCache is the string keyed, untyped flavor of TypedAsyncCache.
+type AsyncCache = TypedAsyncCache[string, interface{}]
+
+// asyncCache is the concrete type returned by NewAsyncCache.
+type asyncCache = typedAsyncCache[string, interface{}]
+
+var (
+	_ AsyncCache                       = (*asyncCache)(nil)
+	_ CtxGetter[string, interface{}]   = (*asyncCache)(nil)
+	_ MetaGetter[string, interface{}]  = (*asyncCache)(nil)
+	_ BatchGetter[string, interface{}] = (*asyncCache)(nil)
+	_ Refresher[string, interface{}]   = (*asyncCache)(nil)
+	_ Invalidator[string]              = (*asyncCache)(nil)
+	_ StatsProvider                    = (*asyncCache)(nil)
+	_ Snapshotter                      = (*asyncCache)(nil)
+	_ CtxCloser                        = (*asyncCache)(nil)
+)
+
+// typedAsyncCache .
+type typedAsyncCache[K comparable, V any] struct {
+	// the 64-bit atomic fields are kept first to be aligned on 32-bit platforms.
+	seq       uint64 // generates the seq of scheduled entries
+	bytes     int64
+	evictions uint64
+	stats     cacheStats
+
+	sfg    flightGroup[K, V]
+	rfg    flightGroup[K, V] // for Refresh, which must not share the fetches of gets reading the L2Store
+	epochs fetchEpochs[K]
+	opt    TypedOptions[K, V]
+	data   Storage[K]
+	wheel  timingWheel[K]
+
+	// refreshing and expiring are set while a tick is being handled.
+	refreshing int32
+	expiring   int32
+
+	// drain tracks the in-flight ticks and handler callbacks for CloseCtx.
+	drain *drainer
+
+	// all the writes to data are serialized by evictMu, so that entries is exact.
+	evictMu sync.Mutex
+	entries int
+	// bounded is true if MaxEntries or MaxBytes is set.
+	bounded bool
+	policy  EvictionPolicy[K]
+	reads   readBuffer[K] // the reads not applied to policy yet
 }
 
 type tickerType int
@@ -83,12 +275,18 @@ const (
 	expireTicker
 )
 
+// tickable is implemented by every instantiation of typedAsyncCache,
+// so that caches of different types can share the same ticker.
+type tickable interface {
+	onTick(tt tickerType)
+}
+
 type sharedTicker struct {
 	sync.Mutex
 	started  bool
-	stopChan chan bool
+	stopChan chan struct{} // closed to stop the ticker, a new one is made on each start
 	ticker   *time.Ticker
-	caches   map[*asyncCache]struct{}
+	caches   map[tickable]struct{}
 }
 
 var (
@@ -96,74 +294,160 @@ var (
 	refreshTickerMap, expireTickerMap sync.Map
 )
 
-type entry struct {
-	val    atomic.Value
-	expire int32 // 0 means useful, 1 will expire
-	err    Error
+type entry[V any] struct {
+	// the 64-bit atomic fields are kept first to be aligned on 32-bit platforms.
+	size         int64  // measured by Sizer, guarded by evictMu
+	seq          uint64 // seq of the latest scheduling
+	refreshTicks uint64 // refresh duration in RefreshTick
+	updatedAt    int64  // unix nano when the value is set
+	retryAt      int64  // unix nano after which an errored entry is fetched again by gets
+
+	val  atomic.Value // valueHolder[V]
+	idle int32        // number of expire ticks without access
+	err  Error
+
+	expireTicks int32 // expire duration in ExpireDuration
+
+	stale    int32 // 1 if the latest refreshing failed
+	failures int32 // consecutive failures of an errored entry
 }
 
-func (e *entry) Store(x interface{}, err error) {
-	if x != nil {
-		e.val.Store(x)
-	} else {
-		e.val = atomic.Value{}
+// valueHolder is non-nil holder for the cached value.
+// atomic.Value panics on saving nil object or values of inconsistent types.
+type valueHolder[V any] struct{ v V }
+
+func (e *entry[V]) Load() (v V) {
+	if h, ok := e.val.Load().(valueHolder[V]); ok {
+		v = h.v
 	}
+	return
+}
+
+func (e *entry[V]) Store(x V, err error) {
+	e.val.Store(valueHolder[V]{v: x})
 	e.err.Store(err)
 }
 
-func (e *entry) Touch() {
-	atomic.StoreInt32(&e.expire, 0)
+func (e *entry[V]) Touch() {
+	atomic.StoreInt32(&e.idle, 0)
 }
 
 // NewAsyncCache creates an AsyncCache.
 func NewAsyncCache(opt Options) AsyncCache {
-	c := &asyncCache{
-		sfg: sf.Group{},
-		opt: opt,
+	return NewTypedAsyncCache(opt)
+}
+
+// NewTypedAsyncCache creates a TypedAsyncCache.
+func NewTypedAsyncCache[K comparable, V any](opt TypedOptions[K, V]) TypedAsyncCache[K, V] {
+	return newTypedAsyncCache(opt)
+}
+
+func newTypedAsyncCache[K comparable, V any](opt TypedOptions[K, V]) *typedAsyncCache[K, V] {
+	c := &typedAsyncCache[K, V]{
+		opt:   opt,
+		stats: newCacheStats(opt.StatsReporter),
+		drain: newDrainer(),
 	}
 	if c.opt.ErrLogFunc == nil {
 		c.opt.ErrLogFunc = func(str string) {
 			log.Println(str)
 		}
 	}
+	if c.opt.MaxEntries < 0 || c.opt.MaxBytes < 0 {
+		panic("asynccache: invalid MaxEntries or MaxBytes")
+	}
+	if c.opt.MaxBytes > 0 && c.opt.Sizer == nil {
+		panic("asynccache: Sizer must be set with MaxBytes")
+	}
+	if c.opt.MaxEntries > 0 || c.opt.MaxBytes > 0 {
+		c.bounded = true
+		if c.opt.NewEvictionPolicy == nil {
+			c.opt.NewEvictionPolicy = NewLRUPolicy[K]
+		}
+		c.policy = c.opt.NewEvictionPolicy()
+		c.reads = newReadBuffer[K]()
+	}
+	if c.opt.RefreshTick == 0 {
+		c.opt.RefreshTick = c.opt.RefreshDuration
+	}
+	if c.opt.Fetcher == nil && c.opt.HintFetcher == nil && c.opt.CtxFetcher == nil && c.opt.BatchFetcher == nil {
+		panic("asynccache: one of Fetcher, HintFetcher, CtxFetcher and BatchFetcher must be set")
+	}
+	if c.opt.BatchSize < 0 {
+		panic("asynccache: invalid BatchSize")
+	}
+	if c.opt.BatchSize == 0 {
+		c.opt.BatchSize = defaultBatchSize
+	}
+	if c.opt.MaxStaleness < 0 || c.opt.NegativeTTL < 0 || c.opt.MaxNegativeTTL < 0 {
+		panic("asynccache: invalid MaxStaleness, NegativeTTL or MaxNegativeTTL")
+	}
+	if c.opt.L2Store != nil && c.opt.L2TTL <= 0 {
+		panic("asynccache: L2TTL must be positive with L2Store")
+	}
+	if c.opt.NewStorage == nil {
+		c.opt.NewStorage = NewSyncMapStorage[K]
+	}
+	c.data = c.opt.NewStorage()
+	if c.opt.SnapshotCodec == nil {
+		c.opt.SnapshotCodec = GobCodec{}
+	}
+	if c.opt.NegativeTTL > 0 && c.opt.MaxNegativeTTL == 0 {
+		c.opt.MaxNegativeTTL = defaultMaxNegativeTTLFactor * c.opt.NegativeTTL
+	}
+	if c.opt.RefreshConcurrency < 0 || c.opt.RefreshRateLimit < 0 ||
+		c.opt.RefreshJitter < 0 || c.opt.RefreshJitter >= 1 {
+		panic("asynccache: invalid RefreshConcurrency, RefreshRateLimit or RefreshJitter")
+	}
+	if c.opt.RefreshConcurrency == 0 {
+		c.opt.RefreshConcurrency = 1
+	}
 	if c.opt.EnableExpire {
 		if c.opt.ExpireDuration == 0 {
 			panic("asynccache: invalid ExpireDuration")
 		}
-		ti, _ := expireTickerMap.LoadOrStore(c.opt.ExpireDuration,
-			&sharedTicker{caches: make(map[*asyncCache]struct{}), stopChan: make(chan bool, 1)})
-		et := ti.(*sharedTicker)
-		et.Lock()
-		et.caches[c] = struct{}{}
-		if !et.started {
-			et.started = true
-			et.ticker = time.NewTicker(c.opt.ExpireDuration)
-			go et.tick(et.ticker, expireTicker)
-		}
-		et.Unlock()
+		register(&expireTickerMap, c.opt.ExpireDuration, expireTicker, c)
 	}
+	register(&refreshTickerMap, c.opt.RefreshTick, refreshTicker, c)
+	return c
+}
 
-	ti, _ := refreshTickerMap.LoadOrStore(c.opt.RefreshDuration,
-		&sharedTicker{caches: make(map[*asyncCache]struct{}), stopChan: make(chan bool, 1)})
-	rt := ti.(*sharedTicker)
-	rt.Lock()
-	rt.caches[c] = struct{}{}
-	if !rt.started {
-		rt.started = true
-		rt.ticker = time.NewTicker(c.opt.RefreshDuration)
-		go rt.tick(rt.ticker, refreshTicker)
+// register adds c to the shared ticker of d, and starts the ticker if it's not started.
+func register(m *sync.Map, d time.Duration, tt tickerType, c tickable) {
+	ti, _ := m.LoadOrStore(d, &sharedTicker{caches: make(map[tickable]struct{})})
+	t := ti.(*sharedTicker)
+	t.Lock()
+	t.caches[c] = struct{}{}
+	if !t.started {
+		t.started = true
+		t.ticker = time.NewTicker(d)
+		t.stopChan = make(chan struct{})
+		go t.tick(t.ticker, t.stopChan, tt)
 	}
-	rt.Unlock()
-	return c
+	t.Unlock()
+}
+
+// unregister removes c from the shared ticker of d, and stops the ticker if no cache is left.
+func unregister(m *sync.Map, d time.Duration, c tickable) {
+	ti, _ := m.Load(d)
+	t := ti.(*sharedTicker)
+	t.Lock()
+	if _, ok := t.caches[c]; ok {
+		delete(t.caches, c)
+		if len(t.caches) == 0 {
+			close(t.stopChan)
+			t.started = false
+		}
+	}
+	t.Unlock()
 }
 
 // SetDefault sets the default value of given key if it is new to the cache.
-func (c *asyncCache) SetDefault(key string, val interface{}) bool {
-	ety := &entry{}
-	ety.Store(val, nil)
-	actual, exist := c.data.LoadOrStore(key, ety)
+func (c *typedAsyncCache[K, V]) SetDefault(key K, val V) bool {
+	ety := c.newEntry(val, nil, FetchHint{})
+	actual, exist := c.loadOrStoreEntry(key, ety)
 	if exist {
-		actual.(*entry).Touch()
+		actual.Touch()
 	}
 	return exist
 }
@@ -171,198 +455,454 @@ func (c *asyncCache) SetDefault(key string, val interface{}) bool {
 // Get tries to fetch a value corresponding to the given key from the cache.
 // If error occurs during in the first time fetching, it will be cached until the
 // sequential fetchings triggered by the refresh goroutine succeed.
-func (c *asyncCache) Get(key string) (val interface{}, err error) {
-	var ok bool
-	val, ok = c.data.Load(key)
-	if ok {
-		e := val.(*entry)
+func (c *typedAsyncCache[K, V]) Get(key K) (val V, err error) {
+	return c.GetCtx(context.Background(), key)
+}
+
+// GetCtx is like Get, but returns ctx.Err() once ctx is done while fetching.
+// The fetch shared with other callers is not canceled, it is called with a context
+// which keeps the values of ctx but is only bounded by FetchTimeout.
+func (c *typedAsyncCache[K, V]) GetCtx(ctx context.Context, key K) (val V, err error) {
+	if c.drain.isClosed() {
+		return val, ErrClosed
+	}
+	if v, ok := c.data.Load(key); ok {
+		e := v.(*entry[V])
 		e.Touch()
-		return e.val.Load(), e.err.Load()
+		c.access(key)
+		if err = e.err.Load(); err != nil && c.shouldRetry(e) {
+			c.stats.recordMiss()
+			return c.retry(ctx, key, e)
+		}
+		c.stats.recordHit()
+		return e.Load(), err
 	}
 
-	val, err, _ = c.sfg.Do(key, func() (v interface{}, e error) {
-		v, e = c.opt.Fetcher(key)
-		ety := &entry{}
-		ety.Store(v, e)
-		c.data.Store(key, ety)
+	c.stats.recordMiss()
+	return c.sfg.DoCtx(ctx, key, func() (v V, e error) {
+		epoch := c.epochs.begin(key)
+		defer c.epochs.end(key)
+		var hint FetchHint
+		v, hint, e = c.fetch(detachedContext{ctx}, key)
+		ety := c.newEntry(v, e, hint)
+		c.storeFetched(key, ety, epoch)
 		return
 	})
-	return
 }
 
 // GetOrSet tries to fetch a value corresponding to the given key from the cache.
 // If the key is not yet cached or fetching failed, the default value will be set.
-func (c *asyncCache) GetOrSet(key string, def interface{}) (val interface{}) {
+func (c *typedAsyncCache[K, V]) GetOrSet(key K, def V) (val V) {
 	if v, ok := c.data.Load(key); ok {
-		e := v.(*entry)
-		if e.err.Load() != nil {
-			ety := &entry{}
-			ety.Store(def, nil)
-			c.data.Store(key, ety)
+		e := v.(*entry[V])
+		if err := e.err.Load(); err != nil {
+			// the error is replaced by the default value, report it.
+			c.onError(key, err)
+			ety := c.newEntry(def, nil, FetchHint{})
+			c.storeEntry(key, ety)
 			return def
 		}
 		e.Touch()
-		return e.val.Load()
+		c.access(key)
+		c.stats.recordHit()
+		return e.Load()
 	}
 
-	val, _, _ = c.sfg.Do(key, func() (interface{}, error) {
-		v, e := c.opt.Fetcher(key)
+	c.stats.recordMiss()
+	if c.drain.isClosed() {
+		// no more fetches after closing.
+		return def
+	}
+	val, _ = c.sfg.Do(key, func() (V, error) {
+		epoch := c.epochs.begin(key)
+		defer c.epochs.end(key)
+		v, hint, e := c.fetch(context.Background(), key)
 		if e != nil {
-			v = def
+			c.onError(key, e)
+			v, hint = def, FetchHint{}
 		}
-		ety := &entry{}
-		ety.Store(v, nil)
-		c.data.Store(key, ety)
+		ety := c.newEntry(v, nil, hint)
+		c.storeFetched(key, ety, epoch)
 		return v, nil
 	})
 	return
 }
 
 // Dump dumps all cached entries.
-func (c *asyncCache) Dump() map[string]interface{} {
-	data := make(map[string]interface{})
-	c.data.Range(func(key, val interface{}) bool {
-		k, ok := key.(string)
-		if !ok {
-			c.opt.ErrLogFunc(fmt.Sprintf("invalid key: %v, type: %T is not string", k, k))
-			c.data.Delete(key)
-			return true
-		}
-		data[k] = val.(*entry).val.Load()
+func (c *typedAsyncCache[K, V]) Dump() map[K]V {
+	data := make(map[K]V)
+	c.data.Range(func(key K, val interface{}) bool {
+		data[key] = val.(*entry[V]).Load()
 		return true
 	})
 	return data
 }
 
 // DeleteIf deletes cached entries that match the `shouldDelete` predicate.
-func (c *asyncCache) DeleteIf(shouldDelete func(key string) bool) {
-	c.data.Range(func(key, value interface{}) bool {
-		s := key.(string)
-		if shouldDelete(s) {
-			if c.opt.DeleteHandler != nil {
-				go c.opt.DeleteHandler(s, value)
-			}
-			c.data.Delete(key)
+func (c *typedAsyncCache[K, V]) DeleteIf(shouldDelete func(key K) bool) {
+	c.data.Range(func(k K, value interface{}) bool {
+		if shouldDelete(k) && c.deleteEntry(k, value.(*entry[V])) {
+			c.onDelete(k, value.(*entry[V]).Load())
 		}
 		return true
 	})
 }
 
-// Close stops the background goroutine.
-func (c *asyncCache) Close() {
-	// close refresh ticker
-	ti, _ := refreshTickerMap.Load(c.opt.RefreshDuration)
-	rt := ti.(*sharedTicker)
-	rt.Lock()
-	delete(rt.caches, c)
-	if len(rt.caches) == 0 {
-		rt.stopChan <- true
-		rt.started = false
-	}
-	rt.Unlock()
+// evictionCount returns the number of evicted entries.
+func (c *typedAsyncCache[K, V]) evictionCount() uint64 {
+	return atomic.LoadUint64(&c.evictions)
+}
 
+// Close stops the background goroutine.
+// It doesn't wait for the in-flight refreshes, see CloseCtx.
+func (c *typedAsyncCache[K, V]) Close() {
+	if !c.drain.close() {
+		return
+	}
+	unregister(&refreshTickerMap, c.opt.RefreshTick, c)
 	if c.opt.EnableExpire {
-		// close expire ticker
-		ti, _ := expireTickerMap.Load(c.opt.ExpireDuration)
-		et := ti.(*sharedTicker)
-		et.Lock()
-		delete(et.caches, c)
-		if len(et.caches) == 0 {
-			et.stopChan <- true
-			et.started = false
-		}
-		et.Unlock()
+		unregister(&expireTickerMap, c.opt.ExpireDuration, c)
+	}
+}
+
+// CloseCtx closes the cache, and waits for the in-flight refreshes and handler callbacks until ctx is done.
+func (c *typedAsyncCache[K, V]) CloseCtx(ctx context.Context) error {
+	c.Close()
+	select {
+	case <-c.drain.wait():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
 // tick .
 // pass ticker but not use t.ticker directly is to ignore race.
-func (t *sharedTicker) tick(ticker *time.Ticker, tt tickerType) {
-	var wg sync.WaitGroup
+// The caches handle the ticks on their own goroutines,
+// so that a slow cache doesn't delay the others.
+func (t *sharedTicker) tick(ticker *time.Ticker, stop <-chan struct{}, tt tickerType) {
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
 			t.Lock()
 			for c := range t.caches {
-				wg.Add(1)
-				go func(c *asyncCache) {
-					defer wg.Done()
-					if tt == expireTicker {
-						c.expire()
-					} else {
-						c.refresh()
-					}
-				}(c)
+				go c.onTick(tt)
 			}
-			wg.Wait()
 			t.Unlock()
-		case stop := <-t.stopChan:
-			if stop {
-				return
-			}
+		case <-stop:
+			return
 		}
 	}
 }
 
-func (c *asyncCache) expire() {
-	c.data.Range(func(key, value interface{}) bool {
-		k, ok := key.(string)
-		if !ok {
-			c.opt.ErrLogFunc(fmt.Sprintf("invalid key: %v, type: %T is not string", k, k))
-			c.data.Delete(key)
-			return true
-		}
-		e, ok := value.(*entry)
-		if !ok {
-			c.opt.ErrLogFunc(fmt.Sprintf("invalid key: %v, type: %T is not entry", k, value))
-			c.data.Delete(key)
-			return true
+// onTick handles a tick of the shared ticker.
+// The tick is skipped if the previous one of the same type is still being handled.
+func (c *typedAsyncCache[K, V]) onTick(tt tickerType) {
+	if !c.drain.enter() {
+		return
+	}
+	defer c.drain.exit()
+	if tt == expireTicker {
+		if atomic.CompareAndSwapInt32(&c.expiring, 0, 1) {
+			c.expire()
+			atomic.StoreInt32(&c.expiring, 0)
 		}
-		if !atomic.CompareAndSwapInt32(&e.expire, 0, 1) {
-			if c.opt.DeleteHandler != nil {
-				go c.opt.DeleteHandler(k, value)
-			}
-			c.data.Delete(key)
+		return
+	}
+	if atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		c.refresh()
+		atomic.StoreInt32(&c.refreshing, 0)
+	}
+}
+
+func (c *typedAsyncCache[K, V]) expire() {
+	c.data.Range(func(key K, value interface{}) bool {
+		e := value.(*entry[V])
+		if atomic.AddInt32(&e.idle, 1) > atomic.LoadInt32(&e.expireTicks) && c.deleteEntry(key, e) {
+			c.onDelete(key, e.Load())
 		}
 
 		return true
 	})
 }
 
-func (c *asyncCache) refresh() {
-	c.data.Range(func(key, value interface{}) bool {
-		k, ok := key.(string)
-		if !ok {
-			c.opt.ErrLogFunc(fmt.Sprintf("invalid key: %v, type: %T is not string", k, k))
-			c.data.Delete(key)
-			return true
-		}
-		e, ok := value.(*entry)
-		if !ok {
-			c.opt.ErrLogFunc(fmt.Sprintf("invalid key: %v, type: %T is not entry", k, value))
-			c.data.Delete(key)
-			return true
+// fetch fetches the value of key from the L2Store, or with the configured fetcher
+// if not found, and writes the fetched value through to the L2Store.
+func (c *typedAsyncCache[K, V]) fetch(ctx context.Context, key K) (v V, hint FetchHint, err error) {
+	if c.opt.L2Store != nil && c.hasFetcher() {
+		if v, ok := c.l2Get(ctx, key); ok {
+			return v, FetchHint{}, nil
 		}
+	}
+	return c.fetchSource(ctx, key, true)
+}
 
-		newVal, err := c.opt.Fetcher(k)
-		if err != nil {
-			if c.opt.ErrorHandler != nil {
-				go c.opt.ErrorHandler(k, err)
-			}
-			if e.err.Load() != nil {
-				e.err.Store(err)
+// fetchSource fetches the value of key with the configured fetcher,
+// and writes the fetched value through to the L2Store.
+// readL2 only matters for BatchFetcher, which consults the L2Store by itself.
+func (c *typedAsyncCache[K, V]) fetchSource(ctx context.Context, key K, readL2 bool) (v V, hint FetchHint, err error) {
+	if !c.hasFetcher() {
+		vals, errs := c.batchFetch([]K{key}, readL2)
+		return vals[key], FetchHint{}, errs[key]
+	}
+	if c.opt.L2Store != nil {
+		defer func() {
+			if err == nil {
+				c.l2Set(ctx, key, v)
 			}
-			return true
+		}()
+	}
+	start := time.Now()
+	v, hint, err = c.callFetcher(ctx, key)
+	failed := 0
+	if err != nil {
+		failed = 1
+	}
+	c.stats.recordLoad(1, failed, time.Since(start))
+	return
+}
+
+// hasFetcher reports whether a fetcher for a single key is set.
+func (c *typedAsyncCache[K, V]) hasFetcher() bool {
+	return c.opt.CtxFetcher != nil || c.opt.HintFetcher != nil || c.opt.Fetcher != nil
+}
+
+func (c *typedAsyncCache[K, V]) callFetcher(ctx context.Context, key K) (V, FetchHint, error) {
+	if c.opt.CtxFetcher != nil {
+		if c.opt.FetchTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.opt.FetchTimeout)
+			defer cancel()
 		}
+		v, err := c.opt.CtxFetcher(ctx, key)
+		return v, FetchHint{}, err
+	}
+	if c.opt.HintFetcher != nil {
+		return c.opt.HintFetcher(key)
+	}
+	v, err := c.opt.Fetcher(key)
+	return v, FetchHint{}, err
+}
 
-		if c.opt.IsSame != nil && !c.opt.IsSame(k, e.val.Load(), newVal) {
-			if c.opt.ChangeHandler != nil {
-				go c.opt.ChangeHandler(k, e.val.Load(), newVal)
-			}
+func (c *typedAsyncCache[K, V]) newEntry(val V, err error, hint FetchHint) *entry[V] {
+	e := &entry[V]{}
+	e.Store(val, err)
+	c.setHint(e, hint)
+	e.updatedAt = time.Now().UnixNano()
+	if err != nil {
+		c.setFailed(e, 1)
+	}
+	return e
+}
+
+// setHint converts the durations of hint to ticks and stores them to e.
+func (c *typedAsyncCache[K, V]) setHint(e *entry[V], hint FetchHint) {
+	refresh := hint.Refresh
+	if refresh <= 0 {
+		refresh = c.opt.RefreshDuration
+	}
+	atomic.StoreUint64(&e.refreshTicks, uint64(durationToTicks(refresh, c.opt.RefreshTick)))
+	if c.opt.EnableExpire {
+		expire := hint.Expire
+		if expire <= 0 {
+			expire = c.opt.ExpireDuration
 		}
+		atomic.StoreInt32(&e.expireTicks, int32(durationToTicks(expire, c.opt.ExpireDuration)))
+	}
+}
 
-		e.Store(newVal, err)
-		return true
+// schedule schedules the next refreshing of e.
+func (c *typedAsyncCache[K, V]) schedule(key K, e *entry[V]) {
+	c.scheduleAfter(key, e, atomic.LoadUint64(&e.refreshTicks))
+}
+
+// scheduleAfter schedules the next refreshing of e after the given ticks.
+func (c *typedAsyncCache[K, V]) scheduleAfter(key K, e *entry[V], ticks uint64) {
+	seq := atomic.AddUint64(&c.seq, 1)
+	atomic.StoreUint64(&e.seq, seq)
+	c.wheel.schedule(key, seq, ticks)
+}
+
+// durationToTicks rounds d up to a positive multiple of tick.
+func durationToTicks(d, tick time.Duration) int64 {
+	n := int64((d + tick - 1) / tick)
+	if n < 1 {
+		n = 1
+	}
+	if n > math.MaxInt32 {
+		n = math.MaxInt32
+	}
+	return n
+}
+
+// storeEntry stores e for key, replacing the existing entry if any.
+func (c *typedAsyncCache[K, V]) storeEntry(key K, e *entry[V]) {
+	c.measure(key, e)
+	c.onEvicted(c.store(key, e))
+}
+
+// storeFetched is like storeEntry, but e is dropped if key has been invalidated
+// since its fetch began at epoch.
+func (c *typedAsyncCache[K, V]) storeFetched(key K, e *entry[V], epoch uint64) {
+	c.measure(key, e)
+	var victims []evicted[K, V]
+	c.epochs.publish(key, epoch, func() {
+		victims = c.store(key, e)
 	})
+	c.onEvicted(victims)
+}
+
+// store stores a measured entry, and returns the entries to be evicted.
+func (c *typedAsyncCache[K, V]) store(key K, e *entry[V]) []evicted[K, V] {
+	c.evictMu.Lock()
+	defer c.evictMu.Unlock()
+	if old, ok := c.data.Load(key); ok {
+		c.unaccount(old.(*entry[V]))
+		if c.bounded {
+			c.policy.Access(key)
+		}
+	} else if c.bounded {
+		c.policy.Add(key)
+	}
+	c.data.Store(key, e)
+	c.account(e)
+	c.schedule(key, e)
+	return c.evictLocked()
+}
+
+// loadOrStoreEntry returns the existing entry for key if present,
+// otherwise it stores and returns e.
+func (c *typedAsyncCache[K, V]) loadOrStoreEntry(key K, e *entry[V]) (actual *entry[V], loaded bool) {
+	c.measure(key, e)
+	c.evictMu.Lock()
+	if old, ok := c.data.Load(key); ok {
+		if c.bounded {
+			c.policy.Access(key)
+		}
+		c.evictMu.Unlock()
+		return old.(*entry[V]), true
+	}
+	if c.bounded {
+		c.policy.Add(key)
+	}
+	c.data.Store(key, e)
+	c.account(e)
+	c.schedule(key, e)
+	victims := c.evictLocked()
+	c.evictMu.Unlock()
+	c.onEvicted(victims)
+	return e, false
+}
+
+// deleteEntry deletes key if it is still mapped to e.
+// It returns false if e has already been removed from the cache.
+func (c *typedAsyncCache[K, V]) deleteEntry(key K, e *entry[V]) bool {
+	c.evictMu.Lock()
+	defer c.evictMu.Unlock()
+	if cur, ok := c.data.Load(key); !ok || cur.(*entry[V]) != e {
+		return false
+	}
+	c.data.Delete(key)
+	c.unaccount(e)
+	if c.bounded {
+		c.policy.Remove(key)
+	}
+	return true
+}
+
+// updateEntry stores a refreshed value to e.
+func (c *typedAsyncCache[K, V]) updateEntry(key K, e *entry[V], val V) {
+	atomic.StoreInt64(&e.updatedAt, time.Now().UnixNano())
+	atomic.StoreInt32(&e.stale, 0)
+	atomic.StoreInt32(&e.failures, 0)
+	if c.opt.MaxBytes == 0 {
+		e.Store(val, nil)
+		return
+	}
+	size := c.opt.Sizer(key, val)
+	c.evictMu.Lock()
+	e.Store(val, nil)
+	if cur, ok := c.data.Load(key); !ok || cur.(*entry[V]) != e {
+		// e has been removed, there is nothing to account.
+		c.evictMu.Unlock()
+		return
+	}
+	c.bytes += size - e.size
+	e.size = size
+	victims := c.evictLocked()
+	c.evictMu.Unlock()
+	c.onEvicted(victims)
+}
+
+// access records a read of key for the eviction policy.
+func (c *typedAsyncCache[K, V]) access(key K) {
+	if c.bounded {
+		c.reads.record(key, &c.evictMu, c.policy)
+	}
+}
+
+type evicted[K comparable, V any] struct {
+	key K
+	val V
+}
+
+// evictLocked evicts entries until the cache fits in its bounds.
+// It must be called with evictMu held.
+func (c *typedAsyncCache[K, V]) evictLocked() (victims []evicted[K, V]) {
+	if !c.overflowLocked() {
+		return nil
+	}
+	// the buffered reads are applied first, so that the recently read keys are kept.
+	c.reads.flush(c.policy)
+	for c.overflowLocked() {
+		key, ok := c.policy.Evict()
+		if !ok {
+			break
+		}
+		v, ok := c.data.Load(key)
+		if !ok {
+			continue
+		}
+		e := v.(*entry[V])
+		c.data.Delete(key)
+		c.unaccount(e)
+		victims = append(victims, evicted[K, V]{key: key, val: e.Load()})
+	}
+	return victims
+}
+
+func (c *typedAsyncCache[K, V]) overflowLocked() bool {
+	return (c.opt.MaxEntries > 0 && c.entries > c.opt.MaxEntries) ||
+		(c.opt.MaxBytes > 0 && c.bytes > c.opt.MaxBytes)
+}
+
+func (c *typedAsyncCache[K, V]) onEvicted(victims []evicted[K, V]) {
+	if len(victims) == 0 {
+		return
+	}
+	atomic.AddUint64(&c.evictions, uint64(len(victims)))
+	if c.stats.reporter != nil {
+		c.stats.reporter.ReportEviction(len(victims))
+	}
+	for _, v := range victims {
+		c.onDelete(v.key, v.val)
+	}
+}
+
+// measure sets the size of a new entry, before it is published.
+func (c *typedAsyncCache[K, V]) measure(key K, e *entry[V]) {
+	if c.opt.MaxBytes > 0 {
+		e.size = c.opt.Sizer(key, e.Load())
+	}
+}
+
+func (c *typedAsyncCache[K, V]) account(e *entry[V]) {
+	c.entries++
+	c.bytes += e.size
+}
+
+func (c *typedAsyncCache[K, V]) unaccount(e *entry[V]) {
+	c.entries--
+	c.bytes -= e.size
 }
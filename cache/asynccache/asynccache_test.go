@@ -16,6 +16,8 @@ package asynccache
 
 import (
 	"errors"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -271,6 +273,83 @@ func TestExpire(t *testing.T) {
 	assert.True(t, trigger)
 }
 
+func TestTypedGet(t *testing.T) {
+	type item struct {
+		id   int
+		name string
+	}
+	var cnt int32
+	op := TypedOptions[int, *item]{
+		RefreshDuration: time.Second,
+		Fetcher: func(key int) (*item, error) {
+			atomic.AddInt32(&cnt, 1)
+			if key < 0 {
+				return nil, errors.New("negative id")
+			}
+			return &item{id: key, name: strconv.Itoa(key)}, nil
+		},
+	}
+	c := NewTypedAsyncCache(op)
+	defer c.Close()
+
+	v, err := c.Get(1)
+	assert.NoError(t, err)
+	assert.Equal(t, &item{id: 1, name: "1"}, v)
+	v, err = c.Get(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v.id)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&cnt))
+
+	v, err = c.Get(-1)
+	assert.Error(t, err)
+	assert.Nil(t, v)
+
+	v = c.GetOrSet(-2, &item{name: "def"})
+	assert.Equal(t, "def", v.name)
+
+	assert.False(t, c.SetDefault(3, &item{id: 3}))
+	assert.Len(t, c.Dump(), 4)
+}
+
+func TestTypedDeleteHandler(t *testing.T) {
+	deleted := make(chan string, 1)
+	op := TypedOptions[string, string]{
+		RefreshDuration: time.Second,
+		Fetcher: func(key string) (string, error) {
+			return "val-" + key, nil
+		},
+		DeleteHandler: func(key string, oldData string) {
+			deleted <- key + "=" + oldData
+		},
+	}
+	c := NewTypedAsyncCache(op)
+	defer c.Close()
+
+	v, err := c.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "val-key", v)
+
+	c.DeleteIf(func(key string) bool { return key == "key" })
+	select {
+	case s := <-deleted:
+		assert.Equal(t, "key=val-key", s)
+	case <-time.After(time.Second):
+		t.Fatal("DeleteHandler not called")
+	}
+	assert.Empty(t, c.Dump())
+}
+
+func TestFlightGroupPanic(t *testing.T) {
+	var g flightGroup[string, int]
+	assert.Panics(t, func() {
+		_, _ = g.Do("key", func() (int, error) { panic("boom") })
+	})
+	// the group must stay usable after a panicking call.
+	v, err := g.Do("key", func() (int, error) { return 1, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
+
 func BenchmarkGet(b *testing.B) {
 	var key = "key"
 	op := Options{
@@ -0,0 +1,153 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+const defaultBatchSize = 100
+
+// ErrNotFetched is returned for the keys missing in the result of BatchFetcher.
+var ErrNotFetched = errors.New("asynccache: key is missing in the result of BatchFetcher")
+
+// MGet gets the values of keys, the missing keys are fetched by a single BatchFetcher call.
+// Falls back to Get for each key if BatchFetcher is not set.
+func (c *typedAsyncCache[K, V]) MGet(keys ...K) (vals map[K]V, errs map[K]error) {
+	vals = make(map[K]V, len(keys))
+	setErr := func(key K, err error) {
+		if errs == nil {
+			errs = make(map[K]error)
+		}
+		errs[key] = err
+	}
+	if c.drain.isClosed() {
+		for _, key := range keys {
+			setErr(key, ErrClosed)
+		}
+		return vals, errs
+	}
+	if c.opt.BatchFetcher == nil {
+		for _, key := range keys {
+			if v, err := c.Get(key); err != nil {
+				setErr(key, err)
+			} else {
+				vals[key] = v
+			}
+		}
+		return vals, errs
+	}
+
+	var misses []K
+	for _, key := range keys {
+		v, ok := c.data.Load(key)
+		if !ok {
+			c.stats.recordMiss()
+			misses = append(misses, key)
+			continue
+		}
+		e := v.(*entry[V])
+		e.Touch()
+		c.access(key)
+		if err := e.err.Load(); err != nil && c.shouldRetry(e) {
+			c.stats.recordMiss()
+			misses = append(misses, key)
+			continue
+		} else if err != nil {
+			setErr(key, err)
+		} else {
+			vals[key] = e.Load()
+		}
+		c.stats.recordHit()
+	}
+	if len(misses) == 0 {
+		return vals, errs
+	}
+
+	fetched, fetchErrs := c.sfg.DoBatch(misses, func(keys []K) (map[K]V, map[K]error) {
+		epochs := make([]uint64, len(keys))
+		for i, key := range keys {
+			epochs[i] = c.epochs.begin(key)
+			defer c.epochs.end(key)
+		}
+		vals, errs := c.batchFetch(keys, true)
+		for i, key := range keys {
+			e := c.newEntry(vals[key], errs[key], FetchHint{})
+			if errs[key] != nil {
+				// keep backing off like retry if key has failed before.
+				if v, ok := c.data.Load(key); ok {
+					if old := v.(*entry[V]); old.err.Load() != nil {
+						c.setFailed(e, atomic.LoadInt32(&old.failures)+1)
+					}
+				}
+			}
+			c.storeFetched(key, e, epochs[i])
+		}
+		return vals, errs
+	})
+	for key, v := range fetched {
+		vals[key] = v
+	}
+	for key, err := range fetchErrs {
+		setErr(key, err)
+	}
+	return vals, errs
+}
+
+// batchFetch calls BatchFetcher, and sets ErrNotFetched for the keys missing in its results.
+// Like fetch, the L2Store is consulted first if readL2 is true, and the fetched values are written through to it.
+func (c *typedAsyncCache[K, V]) batchFetch(keys []K, readL2 bool) (map[K]V, map[K]error) {
+	vals := make(map[K]V, len(keys))
+	errs := make(map[K]error)
+	if c.opt.L2Store != nil && readL2 {
+		misses := keys[:0:0]
+		for _, key := range keys {
+			if v, ok := c.l2Get(context.Background(), key); ok {
+				vals[key] = v
+			} else {
+				misses = append(misses, key)
+			}
+		}
+		if len(misses) == 0 {
+			return vals, errs
+		}
+		keys = misses
+		defer func() {
+			for _, key := range keys {
+				if _, failed := errs[key]; !failed {
+					c.l2Set(context.Background(), key, vals[key])
+				}
+			}
+		}()
+	}
+
+	start := time.Now()
+	fetched, fetchErrs := c.opt.BatchFetcher(keys)
+	d := time.Since(start)
+	for _, key := range keys {
+		if err := fetchErrs[key]; err != nil {
+			errs[key] = err
+		} else if v, ok := fetched[key]; ok {
+			vals[key] = v
+		} else {
+			errs[key] = ErrNotFetched
+		}
+	}
+	c.stats.recordLoad(len(keys), len(errs), d)
+	return vals, errs
+}
@@ -0,0 +1,159 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMGet(t *testing.T) {
+	var mu sync.Mutex
+	var calls [][]int
+	op := TypedOptions[int, string]{
+		RefreshDuration: time.Minute,
+		BatchFetcher: func(keys []int) (map[int]string, map[int]error) {
+			mu.Lock()
+			sorted := append([]int(nil), keys...)
+			sort.Ints(sorted)
+			calls = append(calls, sorted)
+			mu.Unlock()
+			vals, errs := make(map[int]string), make(map[int]error)
+			for _, k := range keys {
+				switch {
+				case k < 0:
+					errs[k] = errors.New("negative")
+				case k == 0:
+					// missing
+				default:
+					vals[k] = strconv.Itoa(k)
+				}
+			}
+			return vals, errs
+		},
+	}
+	c := newTypedAsyncCache(op)
+	defer c.Close()
+
+	v, err := c.Get(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", v)
+
+	vals, errs := c.MGet(1, 2, 3, 3, -1, 0)
+	assert.Equal(t, map[int]string{1: "1", 2: "2", 3: "3"}, vals)
+	assert.Len(t, errs, 2)
+	assert.EqualError(t, errs[-1], "negative")
+	assert.Equal(t, ErrNotFetched, errs[0])
+	// all the misses are fetched by one call, and the errors are cached.
+	vals, errs = c.MGet(2, 3, -1)
+	assert.Len(t, vals, 2)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, [][]int{{1}, {-1, 0, 2, 3}}, calls)
+}
+
+func TestMGetDedup(t *testing.T) {
+	var fetched int32
+	release := make(chan struct{})
+	op := TypedOptions[string, string]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key string) (string, error) {
+			<-release
+			atomic.AddInt32(&fetched, 1)
+			return key, nil
+		},
+		BatchFetcher: func(keys []string) (map[string]string, map[string]error) {
+			vals := make(map[string]string)
+			for _, k := range keys {
+				atomic.AddInt32(&fetched, 1)
+				vals[k] = k
+			}
+			return vals, nil
+		},
+	}
+	c := newTypedAsyncCache(op)
+	defer c.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		v, err := c.Get("a")
+		assert.NoError(t, err)
+		assert.Equal(t, "a", v)
+	}()
+	time.Sleep(50 * time.Millisecond) // let Get("a") be in-flight
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+	vals, errs := c.MGet("a", "b")
+	assert.Nil(t, errs)
+	assert.Equal(t, map[string]string{"a": "a", "b": "b"}, vals)
+	<-done
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetched))
+}
+
+func TestBatchRefresh(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	ver := 0
+	op := TypedOptions[int, int]{
+		RefreshDuration: time.Minute,
+		BatchFetcher: func(keys []int) (map[int]int, map[int]error) {
+			mu.Lock()
+			sizes = append(sizes, len(keys))
+			mu.Unlock()
+			vals, errs := make(map[int]int), make(map[int]error)
+			for _, k := range keys {
+				if k == 0 && ver > 0 {
+					errs[k] = errors.New("error")
+					continue
+				}
+				vals[k] = k + ver
+			}
+			return vals, errs
+		},
+		BatchSize: 4,
+	}
+	c := NewTypedAsyncCache(op).(*typedAsyncCache[int, int])
+	defer c.Close()
+
+	keys := make([]int, 10)
+	for i := range keys {
+		keys[i] = i
+	}
+	vals, errs := c.MGet(keys...)
+	assert.Nil(t, errs)
+	assert.Len(t, vals, 10)
+
+	ver = 100
+	c.refresh()
+	sort.Ints(sizes[1:])
+	assert.Equal(t, []int{10, 2, 4, 4}, sizes)
+	for k, v := range c.Dump() {
+		if k == 0 {
+			assert.Equal(t, 0, v) // the old value is kept on error
+		} else {
+			assert.Equal(t, k+100, v)
+		}
+	}
+}
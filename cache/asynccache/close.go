@@ -0,0 +1,147 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by the gets of a closed cache.
+var ErrClosed = errors.New("asynccache: cache is closed")
+
+// drainer tracks the in-flight ticks and handler callbacks of a cache,
+// so that closing can wait for them to be done.
+type drainer struct {
+	mu      sync.Mutex
+	closed  bool
+	n       int
+	done    chan struct{} // closed on closing
+	drained chan struct{} // closed when n drops to 0 after closing
+}
+
+func newDrainer() *drainer {
+	return &drainer{done: make(chan struct{})}
+}
+
+// enter starts a tick, it fails if the cache is closed.
+func (d *drainer) enter() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return false
+	}
+	d.n++
+	return true
+}
+
+// add starts a handler callback, which is still run after closing,
+// e.g. it's triggered by an in-flight refresh.
+func (d *drainer) add() {
+	d.mu.Lock()
+	d.n++
+	d.mu.Unlock()
+}
+
+// exit ends a tick or handler callback.
+func (d *drainer) exit() {
+	d.mu.Lock()
+	d.n--
+	if d.n == 0 && d.drained != nil {
+		close(d.drained)
+		d.drained = nil
+	}
+	d.mu.Unlock()
+}
+
+// close marks the cache closed, it returns false if it's already closed.
+func (d *drainer) close() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return false
+	}
+	d.closed = true
+	close(d.done)
+	return true
+}
+
+func (d *drainer) isClosed() bool {
+	select {
+	case <-d.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait returns a channel closed when all the in-flight ticks and handler callbacks are done.
+func (d *drainer) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.drained == nil {
+		d.drained = make(chan struct{})
+		if d.n == 0 {
+			close(d.drained)
+			ch := d.drained
+			d.drained = nil
+			return ch
+		}
+	}
+	return d.drained
+}
+
+// sleep sleeps for d, it returns false if the cache is closed in the meantime.
+func (c *typedAsyncCache[K, V]) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return !c.drain.isClosed()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-c.drain.done:
+		return false
+	}
+}
+
+// goHandler runs a handler callback on a new goroutine, tracked by the drainer.
+func (c *typedAsyncCache[K, V]) goHandler(fn func()) {
+	c.drain.add()
+	go func() {
+		defer c.drain.exit()
+		fn()
+	}()
+}
+
+func (c *typedAsyncCache[K, V]) onError(key K, err error) {
+	if c.opt.ErrorHandler != nil {
+		c.goHandler(func() { c.opt.ErrorHandler(key, err) })
+	}
+}
+
+func (c *typedAsyncCache[K, V]) onDelete(key K, val V) {
+	if c.opt.DeleteHandler != nil {
+		c.goHandler(func() { c.opt.DeleteHandler(key, val) })
+	}
+}
+
+func (c *typedAsyncCache[K, V]) onChange(key K, oldVal, newVal V) {
+	if c.opt.ChangeHandler != nil {
+		c.goHandler(func() { c.opt.ChangeHandler(key, oldVal, newVal) })
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloseCtx(t *testing.T) {
+	var fetched, changed int32
+	block := make(chan struct{})
+	c := newTypedAsyncCache(TypedOptions[string, int32]{
+		RefreshDuration: 10 * time.Millisecond,
+		Fetcher: func(key string) (int32, error) {
+			n := atomic.AddInt32(&fetched, 1)
+			if n > 1 {
+				<-block
+			}
+			return n, nil
+		},
+		IsSame: func(key string, oldData, newData int32) bool {
+			return false
+		},
+		ChangeHandler: func(key string, oldData, newData int32) {
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&changed, 1)
+		},
+	})
+
+	v, err := c.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), v)
+	// wait for the refreshing to block
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&fetched) > 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, c.CloseCtx(ctx))
+	_, err = c.Get("key")
+	assert.Equal(t, ErrClosed, err)
+	_, err = c.Refresh("key")
+	assert.Equal(t, ErrClosed, err)
+	_, errs := c.MGet("key")
+	assert.Equal(t, map[string]error{"key": ErrClosed}, errs)
+	assert.Equal(t, int32(1), c.GetOrSet("key", -1))
+	assert.Equal(t, int32(-1), c.GetOrSet("none", -1))
+
+	// the in-flight refreshing and its ChangeHandler are waited for
+	close(block)
+	assert.NoError(t, c.CloseCtx(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&changed))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetched))
+	c.Close()
+}
+
+func TestCloseInterruptsPacing(t *testing.T) {
+	c := newTypedAsyncCache(TypedOptions[string, string]{
+		RefreshDuration:  time.Hour,
+		RefreshRateLimit: 1,
+		Fetcher: func(key string) (string, error) {
+			return key, nil
+		},
+	})
+	for _, k := range []string{"a", "b", "c"} {
+		c.SetDefault(k, k)
+	}
+	done := make(chan struct{})
+	go func() {
+		c.refreshDue(c.dueEntries())
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	assert.NoError(t, c.CloseCtx(context.Background()))
+	<-done
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestCloseRestartTicker(t *testing.T) {
+	op := TypedOptions[string, string]{
+		RefreshDuration: 13 * time.Millisecond,
+		Fetcher: func(key string) (string, error) {
+			return key, nil
+		},
+		EnableExpire:   true,
+		ExpireDuration: 13 * time.Millisecond,
+	}
+	for i := 0; i < 3; i++ {
+		c := NewTypedAsyncCache(op)
+		c.Get("key")
+		c.Close()
+		c.Close()
+	}
+
+	var refreshed int32
+	op.Fetcher = func(key string) (string, error) {
+		atomic.AddInt32(&refreshed, 1)
+		return key, nil
+	}
+	c := NewTypedAsyncCache(op)
+	defer c.Close()
+	c.Get("key")
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&refreshed) > 1 }, time.Second, time.Millisecond)
+}
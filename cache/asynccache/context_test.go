@@ -0,0 +1,106 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ctxKey struct{}
+
+func TestGetCtx(t *testing.T) {
+	var fetched int32
+	release := make(chan struct{})
+	op := TypedOptions[string, string]{
+		RefreshDuration: time.Minute,
+		CtxFetcher: func(ctx context.Context, key string) (string, error) {
+			atomic.AddInt32(&fetched, 1)
+			<-release
+			if _, ok := ctx.Deadline(); ok {
+				return "", ctx.Err()
+			}
+			return ctx.Value(ctxKey{}).(string), nil
+		},
+	}
+	c := newTypedAsyncCache(op)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "traced"), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.GetCtx(ctx, "key")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// the shared fetch keeps running for the other callers.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	v, err := c.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "traced", v)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetched))
+
+	// hits never block
+	v, err = c.GetCtx(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "traced", v)
+}
+
+func TestFetchTimeout(t *testing.T) {
+	var slow int32
+	op := TypedOptions[string, string]{
+		RefreshDuration: time.Minute,
+		CtxFetcher: func(ctx context.Context, key string) (string, error) {
+			if atomic.LoadInt32(&slow) == 0 {
+				return key, nil
+			}
+			<-ctx.Done()
+			return "", ctx.Err()
+		},
+		FetchTimeout: 20 * time.Millisecond,
+	}
+	c := NewTypedAsyncCache(op).(*typedAsyncCache[string, string])
+	defer c.Close()
+
+	v, err := c.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", v)
+
+	atomic.StoreInt32(&slow, 1)
+	start := time.Now()
+	c.refresh()
+	assert.Less(t, time.Since(start), time.Second)
+	v, err = c.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", v)
+
+	_, err = c.Get("b")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestFlightGroupDoCtxPanic(t *testing.T) {
+	var g flightGroup[string, int]
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := g.DoCtx(ctx, "key", func() (int, error) { panic("boom") })
+	assert.Error(t, err)
+}
@@ -0,0 +1,214 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"container/list"
+	"sort"
+)
+
+// EvictionPolicy decides which entry should be evicted when a bounded cache is full.
+// Implementations don't need to be safe for concurrent use, calls are serialized by the cache.
+type EvictionPolicy[K comparable] interface {
+	// Add is called when a new key is inserted into the cache.
+	Add(key K)
+	// Access is called when a key is read from the cache. The reads are applied in batches,
+	// and some of them are dropped under contention.
+	Access(key K)
+	// Remove is called when a key leaves the cache for other reasons than eviction,
+	// e.g. it expires or is deleted by DeleteIf.
+	Remove(key K)
+	// Evict removes the key that should be evicted next from the policy and returns it.
+	// ok is false if the policy tracks no key.
+	Evict() (key K, ok bool)
+}
+
+// NewLRUPolicy creates an EvictionPolicy which evicts the least recently used key.
+func NewLRUPolicy[K comparable]() EvictionPolicy[K] {
+	return &lruPolicy[K]{
+		ll:    list.New(),
+		items: make(map[K]*list.Element),
+	}
+}
+
+type lruPolicy[K comparable] struct {
+	ll    *list.List // front is the most recently used
+	items map[K]*list.Element
+}
+
+func (p *lruPolicy[K]) Add(key K) {
+	if e, ok := p.items[key]; ok {
+		p.ll.MoveToFront(e)
+		return
+	}
+	p.items[key] = p.ll.PushFront(key)
+}
+
+func (p *lruPolicy[K]) Access(key K) {
+	if e, ok := p.items[key]; ok {
+		p.ll.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy[K]) Remove(key K) {
+	if e, ok := p.items[key]; ok {
+		p.ll.Remove(e)
+		delete(p.items, key)
+	}
+}
+
+func (p *lruPolicy[K]) Evict() (key K, ok bool) {
+	e := p.ll.Back()
+	if e == nil {
+		return
+	}
+	key = p.ll.Remove(e).(K)
+	delete(p.items, key)
+	return key, true
+}
+
+// lfuAgingFactor is the number of accesses per tracked key after which
+// the frequencies of a LFU policy are halved.
+const lfuAgingFactor = 10
+
+// NewLFUPolicy creates an EvictionPolicy which evicts the least frequently used key,
+// the least recently used one is evicted among keys with the same frequency.
+//
+// Frequencies are aged: they are halved every time the number of accesses
+// reaches lfuAgingFactor times the number of tracked keys, so that keys which
+// used to be hot don't stay forever and new keys get a chance to be kept.
+// Add, Access and Remove are O(1) amortized, Evict has to scan the frequencies
+// in use when the least one is unknown after a Remove.
+func NewLFUPolicy[K comparable]() EvictionPolicy[K] {
+	return &lfuPolicy[K]{
+		items: make(map[K]*list.Element),
+		freqs: make(map[uint64]*list.List),
+	}
+}
+
+type lfuItem[K comparable] struct {
+	key  K
+	freq uint64
+}
+
+type lfuPolicy[K comparable] struct {
+	items   map[K]*list.Element   // value is *lfuItem[K]
+	freqs   map[uint64]*list.List // front is the most recently used of the frequency
+	minFreq uint64
+	ops     int // accesses since the last aging
+}
+
+func (p *lfuPolicy[K]) Add(key K) {
+	if _, ok := p.items[key]; ok {
+		p.Access(key)
+		return
+	}
+	p.items[key] = p.bucket(1).PushFront(&lfuItem[K]{key: key, freq: 1})
+	p.minFreq = 1
+	p.tick()
+}
+
+func (p *lfuPolicy[K]) Access(key K) {
+	e, ok := p.items[key]
+	if !ok {
+		return
+	}
+	it := e.Value.(*lfuItem[K])
+	p.unlink(e, it.freq)
+	it.freq++
+	p.items[key] = p.bucket(it.freq).PushFront(it)
+	p.tick()
+}
+
+// tick counts an access and ages the frequencies once there are enough of them.
+func (p *lfuPolicy[K]) tick() {
+	p.ops++
+	if p.ops < lfuAgingFactor*len(p.items) {
+		return
+	}
+	p.ops = 0
+	old := make([]uint64, 0, len(p.freqs))
+	for freq := range p.freqs {
+		old = append(old, freq)
+	}
+	sort.Slice(old, func(i, j int) bool { return old[i] < old[j] })
+	buckets := p.freqs
+	p.freqs = make(map[uint64]*list.List, len(buckets))
+	p.minFreq = 0
+	// Keys are moved from the least frequent and least recently used ones,
+	// so that they stay behind the others if their frequencies collapse.
+	for _, freq := range old {
+		l := buckets[freq]
+		for e := l.Back(); e != nil; e = e.Prev() {
+			it := e.Value.(*lfuItem[K])
+			if it.freq /= 2; it.freq == 0 {
+				it.freq = 1
+			}
+			if p.minFreq == 0 || it.freq < p.minFreq {
+				p.minFreq = it.freq
+			}
+			p.items[it.key] = p.bucket(it.freq).PushFront(it)
+		}
+	}
+}
+
+func (p *lfuPolicy[K]) Remove(key K) {
+	if e, ok := p.items[key]; ok {
+		p.unlink(e, e.Value.(*lfuItem[K]).freq)
+		delete(p.items, key)
+	}
+}
+
+func (p *lfuPolicy[K]) Evict() (key K, ok bool) {
+	if len(p.items) == 0 {
+		return
+	}
+	l := p.freqs[p.minFreq]
+	if l == nil {
+		// minFreq is stale after Remove, find the real one.
+		p.minFreq = 0
+		for freq := range p.freqs {
+			if p.minFreq == 0 || freq < p.minFreq {
+				p.minFreq = freq
+			}
+		}
+		l = p.freqs[p.minFreq]
+	}
+	e := l.Back()
+	key = e.Value.(*lfuItem[K]).key
+	p.unlink(e, p.minFreq)
+	delete(p.items, key)
+	return key, true
+}
+
+func (p *lfuPolicy[K]) bucket(freq uint64) *list.List {
+	l, ok := p.freqs[freq]
+	if !ok {
+		l = list.New()
+		p.freqs[freq] = l
+	}
+	return l
+}
+
+func (p *lfuPolicy[K]) unlink(e *list.Element, freq uint64) {
+	l := p.freqs[freq]
+	l.Remove(e)
+	if l.Len() == 0 {
+		delete(p.freqs, freq)
+		if p.minFreq == freq {
+			p.minFreq++
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUPolicy(t *testing.T) {
+	p := NewLRUPolicy[int]()
+	for i := 1; i <= 3; i++ {
+		p.Add(i)
+	}
+	p.Access(1)
+	p.Remove(3)
+
+	k, ok := p.Evict()
+	assert.True(t, ok)
+	assert.Equal(t, 2, k)
+	k, ok = p.Evict()
+	assert.True(t, ok)
+	assert.Equal(t, 1, k)
+	_, ok = p.Evict()
+	assert.False(t, ok)
+}
+
+func TestLFUPolicy(t *testing.T) {
+	p := NewLFUPolicy[int]()
+	for i := 1; i <= 4; i++ {
+		p.Add(i)
+	}
+	p.Access(1)
+	p.Access(1)
+	p.Access(2)
+	p.Access(3)
+	p.Remove(4)
+
+	// 2 and 3 have the same frequency, the least recently used one goes first.
+	var keys []int
+	for {
+		k, ok := p.Evict()
+		if !ok {
+			break
+		}
+		keys = append(keys, k)
+	}
+	assert.Equal(t, []int{2, 3, 1}, keys)
+
+	// stale minFreq after removing the only least frequently used key.
+	p.Add(5)
+	p.Access(5)
+	p.Add(6)
+	p.Remove(6)
+	k, ok := p.Evict()
+	assert.True(t, ok)
+	assert.Equal(t, 5, k)
+}
+
+func TestLFUPolicyAging(t *testing.T) {
+	p := NewLFUPolicy[int]()
+	p.Add(0)
+	for i := 0; i < 20; i++ {
+		p.Access(0)
+	}
+	// Emulates a cache holding 2 keys, a new key is accessed twice after insertion
+	// but the formerly hot key 0 is never accessed again.
+	for k := 1; k < 100; k++ {
+		p.Add(k)
+		p.Access(k)
+		p.Access(k)
+		evicted, ok := p.Evict()
+		assert.True(t, ok)
+		if evicted == 0 {
+			return
+		}
+		assert.Equal(t, k, evicted)
+	}
+	t.Fatal("the formerly hot key is never evicted")
+}
+
+func TestMaxEntries(t *testing.T) {
+	var mu sync.Mutex
+	deleted := make(map[int]int)
+	op := TypedOptions[int, int]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key int) (int, error) {
+			return key * 10, nil
+		},
+		DeleteHandler: func(key int, oldData int) {
+			mu.Lock()
+			deleted[key] = oldData
+			mu.Unlock()
+		},
+		MaxEntries: 2,
+	}
+	c := newTypedAsyncCache(op)
+	defer c.Close()
+
+	_, _ = c.Get(1)
+	_, _ = c.Get(2)
+	_, _ = c.Get(1) // 2 becomes the least recently used
+	_, _ = c.Get(3)
+
+	assert.Equal(t, map[int]int{1: 10, 3: 30}, c.Dump())
+	assert.Equal(t, uint64(1), c.evictionCount())
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return deleted[2] == 20
+	}, time.Second, 10*time.Millisecond)
+
+	// deleted entries are not counted as evictions and free the space.
+	c.DeleteIf(func(key int) bool { return key == 1 })
+	c.SetDefault(4, 40)
+	assert.Equal(t, map[int]int{3: 30, 4: 40}, c.Dump())
+	assert.Equal(t, uint64(1), c.evictionCount())
+}
+
+func TestMaxBytes(t *testing.T) {
+	size := map[string]string{"a": "1", "b": "22", "c": "333"}
+	op := TypedOptions[string, string]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key string) (string, error) {
+			return size[key], nil
+		},
+		MaxBytes: 5,
+		Sizer: func(key string, val string) int64 {
+			return int64(len(val))
+		},
+		NewEvictionPolicy: NewLFUPolicy[string],
+	}
+	c := NewTypedAsyncCache(op).(*typedAsyncCache[string, string])
+	defer c.Close()
+
+	_, _ = c.Get("a")
+	_, _ = c.Get("a")
+	_, _ = c.Get("b")
+	_, _ = c.Get("c") // 6 bytes, b is evicted
+	assert.Equal(t, map[string]string{"a": "1", "c": "333"}, c.Dump())
+
+	// a refresh growing the value evicts other entries.
+	size["c"] = "4444"
+	c.refresh()
+	assert.Equal(t, map[string]string{"a": "1", "c": "4444"}, c.Dump())
+	size["a"] = "55"
+	c.refresh()
+	assert.Len(t, c.Dump(), 1)
+	assert.Equal(t, uint64(2), c.evictionCount())
+	assert.LessOrEqual(t, c.bytes, int64(5))
+}
+
+func TestMaxEntriesParallelReads(t *testing.T) {
+	op := TypedOptions[int, int]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key int) (int, error) {
+			return key, nil
+		},
+		MaxEntries:        100,
+		NewEvictionPolicy: NewLFUPolicy[int],
+	}
+	c := NewTypedAsyncCache(op).(*typedAsyncCache[int, int])
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				_, _ = c.Get(j % 10) // hot keys
+				_, _ = c.Get(100 + i*1000 + j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	c.evictMu.Lock()
+	assert.Equal(t, 100, c.entries)
+	c.evictMu.Unlock()
+	// the hot keys are kept, even though some of their reads are dropped.
+	dump := c.Dump()
+	for k := 0; k < 10; k++ {
+		assert.Contains(t, dump, k)
+	}
+}
+
+func BenchmarkGetParallelBounded(b *testing.B) {
+	op := TypedOptions[int, int]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key int) (int, error) {
+			return key, nil
+		},
+		MaxEntries: 1024,
+	}
+	c := NewTypedAsyncCache(op)
+	defer c.Close()
+	for i := 0; i < 1024; i++ {
+		_, _ = c.Get(i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_, _ = c.Get(i & 1023)
+			i++
+		}
+	})
+}
@@ -0,0 +1,202 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Invalidator deletes keys from a cache, e.g. when they're changed at the source.
+type Invalidator[K comparable] interface {
+	// Invalidate deletes key.
+	Invalidate(key K)
+	// InvalidatePrefix deletes all the keys with the prefix, and returns the number of deleted keys.
+	// Only string keys, or keys implementing fmt.Stringer, are matched.
+	InvalidatePrefix(prefix string) int
+}
+
+// Invalidation is a message of a change feed, which invalidates Key, or all the keys with Prefix if ByPrefix is true.
+type Invalidation[K comparable] struct {
+	Key      K
+	Prefix   string
+	ByPrefix bool
+}
+
+// SubscribeInvalidations applies the invalidations received from ch to all the targets,
+// until ch is closed.
+func SubscribeInvalidations[K comparable](ch <-chan Invalidation[K], targets ...Invalidator[K]) {
+	go func() {
+		for inv := range ch {
+			for _, t := range targets {
+				if inv.ByPrefix {
+					t.InvalidatePrefix(inv.Prefix)
+				} else {
+					t.Invalidate(inv.Key)
+				}
+			}
+		}
+	}()
+}
+
+// Invalidate deletes key from the cache, and from the L2Store if set.
+func (c *typedAsyncCache[K, V]) Invalidate(key K) {
+	if c.opt.L2Store != nil {
+		c.l2Delete(context.Background(), key)
+	}
+	c.epochs.bump(key)
+	if v, ok := c.data.Load(key); ok {
+		c.invalidate(key, v.(*entry[V]))
+	}
+}
+
+// InvalidatePrefix deletes all the keys with the prefix, from the cache and from the L2Store if set.
+func (c *typedAsyncCache[K, V]) InvalidatePrefix(prefix string) int {
+	n := 0
+	c.epochs.bumpIf(func(k K) bool {
+		s, ok := keyString(k)
+		return ok && strings.HasPrefix(s, prefix)
+	})
+	c.data.Range(func(k K, value interface{}) bool {
+		if s, ok := keyString(k); ok && strings.HasPrefix(s, prefix) {
+			if c.opt.L2Store != nil {
+				c.l2Delete(context.Background(), k)
+			}
+			if c.invalidate(k, value.(*entry[V])) {
+				n++
+			}
+		}
+		return true
+	})
+	return n
+}
+
+// Refresh fetches key immediately, bypassing the L2Store, and returns the fetched value.
+func (c *typedAsyncCache[K, V]) Refresh(key K) (val V, err error) {
+	if c.drain.isClosed() {
+		return val, ErrClosed
+	}
+	return c.rfg.Do(key, func() (v V, e error) {
+		// the values being fetched by gets may come from the L2Store, don't let them
+		// overwrite the refreshed one.
+		c.epochs.bump(key)
+		epoch := c.epochs.begin(key)
+		defer c.epochs.end(key)
+		var hint FetchHint
+		v, hint, e = c.fetchSource(context.Background(), key, false)
+		if old, ok := c.data.Load(key); ok {
+			ety := old.(*entry[V])
+			if e == nil {
+				c.setHint(ety, hint)
+			}
+			c.applyRefresh(key, ety, v, e)
+			return
+		}
+		c.storeFetched(key, c.newEntry(v, e, hint), epoch)
+		return
+	})
+}
+
+// fetchEpochs tracks the epochs of the keys being fetched. Invalidating a key bumps its epoch,
+// so that the fetches begun before don't store their values after the invalidation.
+type fetchEpochs[K comparable] struct {
+	mu sync.Mutex
+	m  map[K]*fetchEpoch
+}
+
+type fetchEpoch struct {
+	epoch uint64
+	refs  int // number of the in-flight fetches
+}
+
+// begin registers a fetch of key and returns the current epoch of key,
+// end must be called once the fetch is done.
+func (fe *fetchEpochs[K]) begin(key K) uint64 {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	if fe.m == nil {
+		fe.m = make(map[K]*fetchEpoch)
+	}
+	e := fe.m[key]
+	if e == nil {
+		e = &fetchEpoch{}
+		fe.m[key] = e
+	}
+	e.refs++
+	return e.epoch
+}
+
+// end unregisters a fetch of key.
+func (fe *fetchEpochs[K]) end(key K) {
+	fe.mu.Lock()
+	e := fe.m[key]
+	e.refs--
+	if e.refs == 0 {
+		delete(fe.m, key)
+	}
+	fe.mu.Unlock()
+}
+
+// publish calls store if key is still at epoch, an invalidation of key
+// either happens before and skips it, or after it returns.
+func (fe *fetchEpochs[K]) publish(key K, epoch uint64, store func()) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	if fe.m[key].epoch == epoch {
+		store()
+	}
+}
+
+// bump bumps the epoch of key if it's being fetched.
+func (fe *fetchEpochs[K]) bump(key K) {
+	fe.mu.Lock()
+	if e := fe.m[key]; e != nil {
+		e.epoch++
+	}
+	fe.mu.Unlock()
+}
+
+// bumpIf bumps the epochs of the keys being fetched which match.
+func (fe *fetchEpochs[K]) bumpIf(match func(key K) bool) {
+	fe.mu.Lock()
+	for k, e := range fe.m {
+		if match(k) {
+			e.epoch++
+		}
+	}
+	fe.mu.Unlock()
+}
+
+func (c *typedAsyncCache[K, V]) invalidate(key K, e *entry[V]) bool {
+	if !c.deleteEntry(key, e) {
+		return false
+	}
+	c.onDelete(key, e.Load())
+	return true
+}
+
+// keyString returns the string form of key, ok is false if key is neither a string nor a fmt.Stringer.
+func keyString(key interface{}) (s string, ok bool) {
+	if str, ok := key.(fmt.Stringer); ok {
+		return str.String(), true
+	}
+	if v := reflect.ValueOf(key); v.Kind() == reflect.String {
+		return v.String(), true
+	}
+	return "", false
+}
@@ -0,0 +1,254 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvalidate(t *testing.T) {
+	var fetched int32
+	var deleted sync.WaitGroup
+	l2 := NewMemoryL2Store[string, int]()
+	c := newTypedAsyncCache(TypedOptions[string, int]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key string) (int, error) {
+			return int(atomic.AddInt32(&fetched, 1)), nil
+		},
+		L2Store: l2,
+		L2TTL:   time.Minute,
+		DeleteHandler: func(key string, oldData int) {
+			deleted.Done()
+		},
+	})
+	defer c.Close()
+
+	v, _ := c.Get("key")
+	assert.Equal(t, 1, v)
+	deleted.Add(1)
+	c.Invalidate("key")
+	deleted.Wait()
+	_, ok, _ := l2.Get(context.Background(), "key")
+	assert.False(t, ok)
+	v, _ = c.Get("key")
+	assert.Equal(t, 2, v)
+
+	// not cached
+	c.Invalidate("none")
+}
+
+func TestInvalidatePrefix(t *testing.T) {
+	c := newTypedAsyncCache(TypedOptions[string, string]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key string) (string, error) {
+			return key, nil
+		},
+	})
+	defer c.Close()
+
+	for _, k := range []string{"user:1", "user:2", "order:1"} {
+		c.Get(k)
+	}
+	assert.Equal(t, 2, c.InvalidatePrefix("user:"))
+	assert.Equal(t, map[string]string{"order:1": "order:1"}, c.Dump())
+
+	// keys neither strings nor fmt.Stringers are never matched
+	ci := newTypedAsyncCache(TypedOptions[int, int]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key int) (int, error) {
+			return key, nil
+		},
+	})
+	defer ci.Close()
+	ci.Get(1)
+	assert.Equal(t, 0, ci.InvalidatePrefix(""))
+}
+
+func TestInvalidateInFlight(t *testing.T) {
+	for _, byPrefix := range []bool{false, true} {
+		var fetched int32
+		entered, release := make(chan struct{}), make(chan struct{})
+		c := newTypedAsyncCache(TypedOptions[string, int]{
+			RefreshDuration: time.Minute,
+			Fetcher: func(key string) (int, error) {
+				if n := atomic.AddInt32(&fetched, 1); n > 1 {
+					return int(n), nil
+				}
+				close(entered)
+				<-release
+				return 1, nil
+			},
+		})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			v, err := c.Get("key")
+			assert.NoError(t, err)
+			assert.Equal(t, 1, v)
+		}()
+		<-entered
+		if byPrefix {
+			c.InvalidatePrefix("k")
+		} else {
+			c.Invalidate("key")
+		}
+		close(release)
+		<-done
+
+		// the value fetched before the invalidation must not be cached.
+		assert.Empty(t, c.Dump())
+		v, err := c.Get("key")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, v)
+		c.Close()
+	}
+}
+
+func TestRefreshKey(t *testing.T) {
+	var fetched int32
+	l2 := NewMemoryL2Store[string, int]()
+	c := newTypedAsyncCache(TypedOptions[string, int]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key string) (int, error) {
+			time.Sleep(10 * time.Millisecond)
+			return int(atomic.AddInt32(&fetched, 1)), nil
+		},
+		L2Store: l2,
+		L2TTL:   time.Minute,
+	})
+	defer c.Close()
+
+	// not cached
+	v, err := c.Refresh("key")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	v, _ = c.Get("key")
+	assert.Equal(t, 1, v)
+
+	// bypasses L2, deduplicated
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.Refresh("key")
+			assert.NoError(t, err)
+			assert.Equal(t, 2, v)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetched))
+	v, _ = c.Get("key")
+	assert.Equal(t, 2, v)
+	v, ok, _ := l2.Get(context.Background(), "key")
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+}
+
+// blockingL2Store blocks Get until release is closed, after reading the value.
+type blockingL2Store struct {
+	*MemoryL2Store[string, int]
+	entered, release chan struct{}
+}
+
+func (s blockingL2Store) Get(ctx context.Context, key string) (int, bool, error) {
+	v, ok, err := s.MemoryL2Store.Get(ctx, key)
+	close(s.entered)
+	<-s.release
+	return v, ok, err
+}
+
+func TestRefreshKeyWhileGet(t *testing.T) {
+	l2 := blockingL2Store{NewMemoryL2Store[string, int](), make(chan struct{}), make(chan struct{})}
+	assert.NoError(t, l2.Set(context.Background(), "key", 100, 0))
+	c := newTypedAsyncCache(TypedOptions[string, int]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key string) (int, error) {
+			return 1, nil
+		},
+		L2Store: l2,
+		L2TTL:   time.Minute,
+	})
+	defer c.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		v, err := c.Get("key")
+		assert.NoError(t, err)
+		assert.Equal(t, 100, v)
+	}()
+	<-l2.entered
+
+	// doesn't share the fetch of Get reading the L2Store.
+	refreshed := make(chan int, 1)
+	go func() {
+		v, err := c.Refresh("key")
+		assert.NoError(t, err)
+		refreshed <- v
+	}()
+	select {
+	case v := <-refreshed:
+		assert.Equal(t, 1, v)
+	case <-time.After(time.Second):
+		t.Error("Refresh waits for the fetch of Get")
+	}
+	close(l2.release)
+	<-done
+
+	// the value read by Get is not stored over the refreshed one.
+	v, err := c.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
+
+func TestSubscribeInvalidations(t *testing.T) {
+	newCache := func() TypedAsyncCache[string, string] {
+		return NewTypedAsyncCache(TypedOptions[string, string]{
+			RefreshDuration: time.Minute,
+			Fetcher: func(key string) (string, error) {
+				return key, nil
+			},
+		})
+	}
+	c1, c2 := newCache(), newCache()
+	defer c1.Close()
+	defer c2.Close()
+	for _, c := range []TypedAsyncCache[string, string]{c1, c2} {
+		for _, k := range []string{"a", "b:1", "b:2", "c"} {
+			c.Get(k)
+		}
+	}
+
+	ch := make(chan Invalidation[string])
+	SubscribeInvalidations(ch, c1.(Invalidator[string]), c2.(Invalidator[string]))
+	ch <- Invalidation[string]{Key: "a"}
+	ch <- Invalidation[string]{Prefix: "b:", ByPrefix: true}
+	close(ch)
+
+	expected := map[string]string{"c": "c"}
+	assert.Eventually(t, func() bool {
+		return len(c1.Dump()) == 1 && len(c2.Dump()) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, expected, c1.Dump())
+	assert.Equal(t, expected, c2.Dump())
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// L2Store is the second level of a tiered cache, e.g. a remote cache shared by many processes.
+// The cache consults it before fetching, and writes the fetched values through to it.
+type L2Store[K comparable, V any] interface {
+	// Get returns the value of key, ok is false if key is not found.
+	Get(ctx context.Context, key K) (val V, ok bool, err error)
+	// Set sets the value of key, which expires after ttl. 0 means no expiration.
+	Set(ctx context.Context, key K, val V, ttl time.Duration) error
+	// Delete deletes key.
+	Delete(ctx context.Context, key K) error
+}
+
+// l2Get gets key from the L2Store, ok is false if it's not found or failed.
+func (c *typedAsyncCache[K, V]) l2Get(ctx context.Context, key K) (v V, ok bool) {
+	ctx, cancel := c.l2Context(ctx)
+	defer cancel()
+	v, ok, err := c.opt.L2Store.Get(ctx, key)
+	if err != nil {
+		c.opt.ErrLogFunc(fmt.Sprintf("asynccache: get key %v from L2Store failed: %v", key, err))
+		return v, false
+	}
+	if ok {
+		atomic.AddInt64(&c.stats.l2Hits, 1)
+	}
+	return v, ok
+}
+
+// l2Set writes v through to the L2Store.
+func (c *typedAsyncCache[K, V]) l2Set(ctx context.Context, key K, v V) {
+	ctx, cancel := c.l2Context(ctx)
+	defer cancel()
+	if err := c.opt.L2Store.Set(ctx, key, v, c.opt.L2TTL); err != nil {
+		c.opt.ErrLogFunc(fmt.Sprintf("asynccache: set key %v to L2Store failed: %v", key, err))
+	}
+}
+
+// l2Delete deletes key from the L2Store, the error is logged.
+func (c *typedAsyncCache[K, V]) l2Delete(ctx context.Context, key K) {
+	ctx, cancel := c.l2Context(ctx)
+	defer cancel()
+	if err := c.opt.L2Store.Delete(ctx, key); err != nil {
+		c.opt.ErrLogFunc(fmt.Sprintf("asynccache: delete key %v from L2Store failed: %v", key, err))
+	}
+}
+
+// l2Context bounds the L2Store calls by FetchTimeout.
+func (c *typedAsyncCache[K, V]) l2Context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.opt.FetchTimeout > 0 {
+		return context.WithTimeout(ctx, c.opt.FetchTimeout)
+	}
+	return ctx, func() {}
+}
+
+// NewMemoryL2Store creates an in-memory L2Store, which is a reference implementation for tests.
+func NewMemoryL2Store[K comparable, V any]() *MemoryL2Store[K, V] {
+	return &MemoryL2Store[K, V]{m: make(map[K]memoryL2Item[V])}
+}
+
+// MemoryL2Store is an in-memory L2Store.
+type MemoryL2Store[K comparable, V any] struct {
+	mu sync.Mutex
+	m  map[K]memoryL2Item[V]
+}
+
+type memoryL2Item[V any] struct {
+	val      V
+	expireAt time.Time // zero means no expiration
+}
+
+// Get implements L2Store.
+func (s *MemoryL2Store[K, V]) Get(ctx context.Context, key K) (val V, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.m[key]
+	if !ok {
+		return val, false, nil
+	}
+	if !it.expireAt.IsZero() && !time.Now().Before(it.expireAt) {
+		delete(s.m, key)
+		return val, false, nil
+	}
+	return it.val, true, nil
+}
+
+// Set implements L2Store.
+func (s *MemoryL2Store[K, V]) Set(ctx context.Context, key K, val V, ttl time.Duration) error {
+	it := memoryL2Item[V]{val: val}
+	if ttl > 0 {
+		it.expireAt = time.Now().Add(ttl)
+	}
+	s.mu.Lock()
+	s.m[key] = it
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete implements L2Store.
+func (s *MemoryL2Store[K, V]) Delete(ctx context.Context, key K) error {
+	s.mu.Lock()
+	delete(s.m, key)
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestL2Store(t *testing.T) {
+	var fetched int32
+	l2 := NewMemoryL2Store[string, int]()
+	op := TypedOptions[string, int]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key string) (int, error) {
+			return int(atomic.AddInt32(&fetched, 1)), nil
+		},
+		L2Store: l2,
+		L2TTL:   50 * time.Millisecond,
+	}
+	c1 := NewTypedAsyncCache(op)
+	defer c1.Close()
+	c2 := NewTypedAsyncCache(op).(*typedAsyncCache[string, int])
+	defer c2.Close()
+
+	// populated on miss
+	v, err := c1.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	v2, ok, _ := l2.Get(context.Background(), "key")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v2)
+
+	// falls through to L2
+	v, err = c2.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetched))
+	assert.Equal(t, uint64(1), c2.Stats().L2Hits)
+
+	// refreshed from L2 until it expires
+	c2.refresh()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetched))
+	time.Sleep(60 * time.Millisecond)
+	c2.refresh()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetched))
+	v, _ = c2.Get("key")
+	assert.Equal(t, 2, v)
+	v2, ok, _ = l2.Get(context.Background(), "key")
+	assert.True(t, ok)
+	assert.Equal(t, 2, v2)
+
+	assert.NoError(t, l2.Delete(context.Background(), "key"))
+	_, ok, _ = l2.Get(context.Background(), "key")
+	assert.False(t, ok)
+}
+
+func TestL2StoreTTL(t *testing.T) {
+	assert.Panics(t, func() {
+		NewTypedAsyncCache(TypedOptions[string, int]{
+			RefreshDuration: time.Minute,
+			Fetcher: func(key string) (int, error) {
+				return 0, nil
+			},
+			L2Store: NewMemoryL2Store[string, int](),
+		})
+	})
+}
+
+type failingL2Store struct{}
+
+func (failingL2Store) Get(ctx context.Context, key string) (string, bool, error) {
+	return "", false, errors.New("get failed")
+}
+
+func (failingL2Store) Set(ctx context.Context, key string, val string, ttl time.Duration) error {
+	return errors.New("set failed")
+}
+
+func (failingL2Store) Delete(ctx context.Context, key string) error {
+	return errors.New("delete failed")
+}
+
+func TestL2StoreError(t *testing.T) {
+	logs := make(chan string, 2)
+	op := TypedOptions[string, string]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key string) (string, error) {
+			return key, nil
+		},
+		L2Store: failingL2Store{},
+		L2TTL:   time.Minute,
+		ErrLogFunc: func(str string) {
+			logs <- str
+		},
+	}
+	c := NewTypedAsyncCache(op)
+	defer c.Close()
+
+	v, err := c.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "key", v)
+	assert.Contains(t, <-logs, "get failed")
+	assert.Contains(t, <-logs, "set failed")
+}
+
+func TestL2StoreBatch(t *testing.T) {
+	var fetched int32
+	l2 := NewMemoryL2Store[int, int]()
+	assert.NoError(t, l2.Set(context.Background(), 1, 100, 0))
+	op := TypedOptions[int, int]{
+		RefreshDuration: time.Minute,
+		BatchFetcher: func(keys []int) (map[int]int, map[int]error) {
+			atomic.AddInt32(&fetched, int32(len(keys)))
+			vals := make(map[int]int)
+			for _, k := range keys {
+				vals[k] = k
+			}
+			return vals, map[int]error{3: errors.New("error")}
+		},
+		L2Store: l2,
+		L2TTL:   time.Minute,
+	}
+	c := newTypedAsyncCache(op)
+	defer c.Close()
+
+	vals, errs := c.MGet(1, 2, 3)
+	assert.Equal(t, map[int]int{1: 100, 2: 2}, vals)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetched))
+	v, ok, _ := l2.Get(context.Background(), 2)
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+	_, ok, _ = l2.Get(context.Background(), 3)
+	assert.False(t, ok)
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/bytedance/gopkg/internal/runtimex"
+)
+
+// readBufferSize is the number of reads a stripe buffers before they're applied to the policy.
+const readBufferSize = 16
+
+type readStripe[K comparable] struct {
+	mu   sync.Mutex
+	keys []K
+	_    [cacheLineSize - 32]byte
+}
+
+// readBuffer records the reads of a bounded cache per P, so that the hits don't contend on evictMu.
+// A full stripe is applied to the policy only if evictMu is free, otherwise the reads are dropped,
+// which is fine since the policy needs the hot keys rather than every read of them.
+type readBuffer[K comparable] []readStripe[K]
+
+func newReadBuffer[K comparable]() readBuffer[K] {
+	b := make(readBuffer[K], runtime.GOMAXPROCS(0))
+	for i := range b {
+		b[i].keys = make([]K, 0, readBufferSize)
+	}
+	return b
+}
+
+// record records a read of key, a full stripe is applied to policy if evictMu is free.
+func (b readBuffer[K]) record(key K, evictMu *sync.Mutex, policy EvictionPolicy[K]) {
+	s := &b[runtimex.Pid()%len(b)]
+	s.mu.Lock()
+	s.keys = append(s.keys, key)
+	if len(s.keys) == readBufferSize {
+		// evictMu is only tried, so that it's always safe to take a stripe with evictMu held.
+		if evictMu.TryLock() {
+			for _, k := range s.keys {
+				policy.Access(k)
+			}
+			evictMu.Unlock()
+		}
+		s.keys = s.keys[:0]
+	}
+	s.mu.Unlock()
+}
+
+// flush applies all the buffered reads to policy, it must be called with evictMu held.
+func (b readBuffer[K]) flush(policy EvictionPolicy[K]) {
+	for i := range b {
+		s := &b[i]
+		s.mu.Lock()
+		for _, k := range s.keys {
+			policy.Access(k)
+		}
+		s.keys = s.keys[:0]
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/gopkg/lang/fastrand"
+)
+
+type dueEntry[K comparable, V any] struct {
+	key   K
+	e     *entry[V]
+	delay time.Duration // jitter from the start of the cycle
+}
+
+// refresh runs a refresh cycle, which fetches all the due entries.
+func (c *typedAsyncCache[K, V]) refresh() {
+	start := time.Now()
+	c.refreshDue(c.dueEntries())
+	d := time.Since(start)
+	overrun := d > c.opt.RefreshTick
+	c.stats.recordRefreshCycle(d, overrun)
+	if c.opt.RefreshCycleHandler != nil {
+		c.opt.RefreshCycleHandler(d, overrun)
+	}
+}
+
+// dueEntries advances the timing wheel and returns the due entries which are still valid.
+func (c *typedAsyncCache[K, V]) dueEntries() []dueEntry[K, V] {
+	items := c.wheel.advance()
+	due := make([]dueEntry[K, V], 0, len(items))
+	for _, it := range items {
+		v, ok := c.data.Load(it.key)
+		if !ok {
+			continue
+		}
+		e := v.(*entry[V])
+		if atomic.LoadUint64(&e.seq) != it.seq {
+			// the entry has been replaced or rescheduled.
+			continue
+		}
+		due = append(due, dueEntry[K, V]{key: it.key, e: e})
+	}
+	return due
+}
+
+// refreshDue fetches the due entries with RefreshConcurrency goroutines,
+// the fetches are paced by RefreshJitter and RefreshRateLimit.
+// With BatchFetcher, the entries are fetched in chunks of BatchSize.
+func (c *typedAsyncCache[K, V]) refreshDue(due []dueEntry[K, V]) {
+	if window := time.Duration(c.opt.RefreshJitter * float64(c.opt.RefreshTick)); window > 0 {
+		for i := range due {
+			due[i].delay = time.Duration(fastrand.Int63n(int64(window)))
+		}
+		sort.Slice(due, func(i, j int) bool { return due[i].delay < due[j].delay })
+	}
+	size := 1
+	if c.opt.BatchFetcher != nil {
+		size = c.opt.BatchSize
+	}
+	chunks := make([][]dueEntry[K, V], 0, (len(due)+size-1)/size)
+	for len(due) > 0 {
+		n := size
+		if n > len(due) {
+			n = len(due)
+		}
+		chunks = append(chunks, due[:n])
+		due = due[n:]
+	}
+
+	paced := c.opt.RefreshJitter > 0 || c.opt.RefreshRateLimit > 0
+	if c.opt.RefreshConcurrency == 1 && !paced {
+		for _, chunk := range chunks {
+			if c.drain.isClosed() {
+				return
+			}
+			c.refreshChunk(chunk)
+		}
+		return
+	}
+
+	workers := c.opt.RefreshConcurrency
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+	ch := make(chan []dueEntry[K, V])
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range ch {
+				c.refreshChunk(chunk)
+			}
+		}()
+	}
+
+	var interval time.Duration
+	if c.opt.RefreshRateLimit > 0 {
+		interval = time.Second / time.Duration(c.opt.RefreshRateLimit)
+	}
+	start := time.Now()
+	next := start
+	for _, chunk := range chunks {
+		at := start.Add(chunk[0].delay)
+		if at.Before(next) {
+			at = next
+		}
+		if !c.sleep(time.Until(at)) {
+			break
+		}
+		ch <- chunk
+		next = at.Add(interval)
+	}
+	close(ch)
+	wg.Wait()
+}
+
+// refreshChunk fetches a chunk of due entries and schedules them again.
+func (c *typedAsyncCache[K, V]) refreshChunk(chunk []dueEntry[K, V]) {
+	if c.opt.BatchFetcher == nil {
+		for _, d := range chunk {
+			c.refreshEntry(d.key, d.e)
+			c.schedule(d.key, d.e)
+		}
+		return
+	}
+
+	keys := make([]K, len(chunk))
+	for i, d := range chunk {
+		keys[i] = d.key
+	}
+	vals, errs := c.batchFetch(keys, true)
+	for _, d := range chunk {
+		c.applyRefresh(d.key, d.e, vals[d.key], errs[d.key])
+		c.schedule(d.key, d.e)
+	}
+}
+
+func (c *typedAsyncCache[K, V]) refreshEntry(k K, e *entry[V]) {
+	newVal, hint, err := c.fetch(context.Background(), k)
+	if err == nil {
+		c.setHint(e, hint)
+	}
+	c.applyRefresh(k, e, newVal, err)
+}
+
+// applyRefresh applies the result of a refreshing fetch to e.
+// The old value is kept if err is not nil.
+func (c *typedAsyncCache[K, V]) applyRefresh(k K, e *entry[V], newVal V, err error) {
+	if err != nil {
+		c.onError(k, err)
+		if e.err.Load() != nil {
+			e.err.Store(err)
+			return
+		}
+		// keep serving the stale value until MaxStaleness.
+		atomic.StoreInt32(&e.stale, 1)
+		if c.opt.MaxStaleness > 0 &&
+			time.Since(time.Unix(0, atomic.LoadInt64(&e.updatedAt))) > c.opt.MaxStaleness &&
+			c.deleteEntry(k, e) {
+			c.onDelete(k, e.Load())
+		}
+		return
+	}
+
+	if c.opt.IsSame != nil && !c.opt.IsSame(k, e.Load(), newVal) {
+		c.onChange(k, e.Load(), newVal)
+	}
+
+	c.updateEntry(k, e, newVal)
+}
@@ -0,0 +1,161 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshConcurrency(t *testing.T) {
+	var running, maxRunning, fetched int32
+	op := TypedOptions[int, int]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key int) (int, error) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&fetched, 1)
+			return key, nil
+		},
+		RefreshConcurrency: 4,
+	}
+	c := NewTypedAsyncCache(op).(*typedAsyncCache[int, int])
+	defer c.Close()
+
+	for i := 0; i < 20; i++ {
+		c.SetDefault(i, 0)
+	}
+	c.refresh()
+	assert.Equal(t, int32(20), atomic.LoadInt32(&fetched))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&maxRunning))
+	for k, v := range c.Dump() {
+		assert.Equal(t, k, v)
+	}
+}
+
+func TestRefreshRateLimit(t *testing.T) {
+	op := TypedOptions[int, int]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key int) (int, error) {
+			return key, nil
+		},
+		RefreshConcurrency: 4,
+		RefreshRateLimit:   50,
+	}
+	c := NewTypedAsyncCache(op).(*typedAsyncCache[int, int])
+	defer c.Close()
+
+	for i := 0; i < 6; i++ {
+		c.SetDefault(i, 0)
+	}
+	start := time.Now()
+	c.refresh()
+	// 6 fetches with 20ms interval in between
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestRefreshJitter(t *testing.T) {
+	var mu sync.Mutex
+	var fetchedAt []time.Time
+	cycles := make(chan time.Duration, 1)
+	op := TypedOptions[string, string]{
+		RefreshDuration: 200 * time.Millisecond,
+		Fetcher: func(key string) (string, error) {
+			mu.Lock()
+			fetchedAt = append(fetchedAt, time.Now())
+			mu.Unlock()
+			return key, nil
+		},
+		RefreshConcurrency: 20,
+		RefreshJitter:      0.5,
+		RefreshCycleHandler: func(duration time.Duration, overrun bool) {
+			select {
+			case cycles <- duration:
+			default:
+			}
+		},
+	}
+	c := NewTypedAsyncCache(op)
+	defer c.Close()
+
+	for i := 0; i < 20; i++ {
+		c.SetDefault(strconv.Itoa(i), "")
+	}
+	d := <-cycles
+	assert.Less(t, d, 200*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.GreaterOrEqual(t, len(fetchedAt), 20)
+	first, last := fetchedAt[0], fetchedAt[0]
+	for _, at := range fetchedAt[:20] {
+		if at.Before(first) {
+			first = at
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+	// 20 fetches spread over 100ms
+	assert.Greater(t, last.Sub(first), 20*time.Millisecond)
+}
+
+func TestRefreshOverrun(t *testing.T) {
+	var fetching, overlapped int32
+	overruns := make(chan bool, 1)
+	op := TypedOptions[string, string]{
+		RefreshDuration: 20 * time.Millisecond,
+		Fetcher: func(key string) (string, error) {
+			if atomic.AddInt32(&fetching, 1) > 1 {
+				atomic.StoreInt32(&overlapped, 1)
+			}
+			time.Sleep(50 * time.Millisecond)
+			atomic.AddInt32(&fetching, -1)
+			return key, nil
+		},
+		RefreshCycleHandler: func(duration time.Duration, overrun bool) {
+			if overrun {
+				select {
+				case overruns <- overrun:
+				default:
+				}
+			}
+		},
+	}
+	c := NewTypedAsyncCache(op)
+	defer c.Close()
+
+	c.SetDefault("key", "")
+	select {
+	case <-overruns:
+	case <-time.After(time.Second):
+		t.Fatal("overrun not reported")
+	}
+	// the ticks are skipped instead of piling up.
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&overlapped))
+}
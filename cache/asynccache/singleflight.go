@@ -0,0 +1,182 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// call is an in-flight or completed flightGroup.Do call.
+type call[V any] struct {
+	done chan struct{}
+	val  V
+	err  error
+}
+
+// flightGroup is a typed variant of golang.org/x/sync/singleflight.Group,
+// which makes it possible to deduplicate fetches of any comparable key.
+type flightGroup[K comparable, V any] struct {
+	mu sync.Mutex
+	m  map[K]*call[V]
+}
+
+// Do executes and returns the results of fn, making sure that only one
+// execution is in-flight for a given key at a time.
+func (g *flightGroup[K, V]) Do(key K, fn func() (V, error)) (V, error) {
+	c, leader := g.join(key)
+	if leader {
+		if r := g.doCall(c, key, fn); r != nil {
+			panic(r)
+		}
+		return c.val, c.err
+	}
+	<-c.done
+	return c.val, c.err
+}
+
+// DoCtx is like Do, but returns ctx.Err() as soon as ctx is done,
+// while fn keeps running for the other callers on a new goroutine.
+// A panic of fn is returned as an error in this case.
+func (g *flightGroup[K, V]) DoCtx(ctx context.Context, key K, fn func() (V, error)) (v V, err error) {
+	if ctx.Done() == nil {
+		// never canceled, run fn on the current goroutine like Do.
+		return g.Do(key, fn)
+	}
+	c, leader := g.join(key)
+	if leader {
+		go g.doCall(c, key, fn)
+	}
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		return v, ctx.Err()
+	}
+}
+
+// join returns the in-flight call of key, or registers a new one.
+// leader is true if the caller must execute the new call.
+func (g *flightGroup[K, V]) join(key K) (c *call[V], leader bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.m == nil {
+		g.m = make(map[K]*call[V])
+	}
+	if c, ok := g.m[key]; ok {
+		return c, false
+	}
+	c = &call[V]{done: make(chan struct{})}
+	g.m[key] = c
+	return c, true
+}
+
+// doCall executes fn for c, and returns the recovered value if fn panics.
+func (g *flightGroup[K, V]) doCall(c *call[V], key K, fn func() (V, error)) (r interface{}) {
+	normalReturn := false
+	defer func() {
+		if !normalReturn {
+			// the waiters get an error instead of blocking forever.
+			r = recover()
+			c.err = fmt.Errorf("asynccache: fetch of key %v panicked: %v", key, r)
+		}
+		g.mu.Lock()
+		delete(g.m, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.val, c.err = fn()
+	normalReturn = true
+	return nil
+}
+
+// DoBatch is the batch version of Do. fn is called once with the keys which are not in-flight,
+// and the results of the other keys are shared from the in-flight calls.
+func (g *flightGroup[K, V]) DoBatch(keys []K, fn func(keys []K) (map[K]V, map[K]error)) (map[K]V, map[K]error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[K]*call[V])
+	}
+	calls := make(map[K]*call[V], len(keys))
+	var own []K
+	for _, key := range keys {
+		if _, ok := calls[key]; ok {
+			continue
+		}
+		c, ok := g.m[key]
+		if !ok {
+			c = &call[V]{done: make(chan struct{})}
+			g.m[key] = c
+			own = append(own, key)
+		}
+		calls[key] = c
+	}
+	g.mu.Unlock()
+
+	if len(own) > 0 {
+		g.doBatchCall(calls, own, fn)
+	}
+	vals := make(map[K]V, len(calls))
+	var errs map[K]error
+	for key, c := range calls {
+		<-c.done
+		if c.err != nil {
+			if errs == nil {
+				errs = make(map[K]error)
+			}
+			errs[key] = c.err
+			continue
+		}
+		vals[key] = c.val
+	}
+	return vals, errs
+}
+
+func (g *flightGroup[K, V]) doBatchCall(calls map[K]*call[V], keys []K, fn func(keys []K) (map[K]V, map[K]error)) {
+	normalReturn := false
+	defer func() {
+		var r interface{}
+		if !normalReturn {
+			r = recover()
+			for _, key := range keys {
+				calls[key].err = fmt.Errorf("asynccache: batch fetch of key %v panicked: %v", key, r)
+			}
+		}
+		g.mu.Lock()
+		for _, key := range keys {
+			delete(g.m, key)
+		}
+		g.mu.Unlock()
+		for _, key := range keys {
+			close(calls[key].done)
+		}
+		if r != nil {
+			panic(r)
+		}
+	}()
+	vals, errs := fn(keys)
+	for _, key := range keys {
+		c := calls[key]
+		if err, ok := errs[key]; ok && err != nil {
+			c.err = err
+		} else if v, ok := vals[key]; ok {
+			c.val = v
+		} else {
+			c.err = ErrNotFetched
+		}
+	}
+	normalReturn = true
+}
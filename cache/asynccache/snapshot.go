@@ -0,0 +1,86 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+)
+
+// Codec encodes and decodes the snapshot of a cache.
+type Codec interface {
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+// GobCodec encodes snapshots with encoding/gob, it is the default codec.
+// The concrete types of interface values must be registered by gob.Register.
+type GobCodec struct{}
+
+// Encode implements Codec.
+func (GobCodec) Encode(w io.Writer, v interface{}) error {
+	return gob.NewEncoder(w).Encode(v)
+}
+
+// Decode implements Codec.
+func (GobCodec) Decode(r io.Reader, v interface{}) error {
+	return gob.NewDecoder(r).Decode(v)
+}
+
+// JSONCodec encodes snapshots with encoding/json.
+// The keys must be strings, integers or implement encoding.TextMarshaler.
+type JSONCodec struct{}
+
+// Encode implements Codec.
+func (JSONCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// Decode implements Codec.
+func (JSONCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// Snapshot writes the cached values to w with SnapshotCodec.
+// Like Dump, it doesn't affect expiring. Errored entries are skipped.
+func (c *typedAsyncCache[K, V]) Snapshot(w io.Writer) error {
+	data := make(map[K]V)
+	c.data.Range(func(key K, val interface{}) bool {
+		if e := val.(*entry[V]); e.err.Load() == nil {
+			data[key] = e.Load()
+		}
+		return true
+	})
+	return c.opt.SnapshotCodec.Encode(w, data)
+}
+
+// Restore reads the values written by Snapshot from r, and sets them
+// to the keys which are not cached yet.
+// The restored entries are served as stale, and refreshed on the next tick.
+func (c *typedAsyncCache[K, V]) Restore(r io.Reader) error {
+	var data map[K]V
+	if err := c.opt.SnapshotCodec.Decode(r, &data); err != nil {
+		return err
+	}
+	for key, val := range data {
+		e := c.newEntry(val, nil, FetchHint{})
+		e.stale = 1
+		if _, loaded := c.loadOrStoreEntry(key, e); !loaded {
+			c.scheduleAfter(key, e, 1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	for name, codec := range map[string]Codec{"gob": GobCodec{}, "json": JSONCodec{}} {
+		t.Run(name, func(t *testing.T) {
+			var fetched int32
+			op := TypedOptions[string, int]{
+				RefreshDuration: time.Minute,
+				Fetcher: func(key string) (int, error) {
+					atomic.AddInt32(&fetched, 1)
+					if key == "bad" {
+						return 0, errors.New("error")
+					}
+					return len(key), nil
+				},
+				SnapshotCodec: codec,
+			}
+			c := newTypedAsyncCache(op)
+			defer c.Close()
+			_, _ = c.Get("a")
+			_, _ = c.Get("bb")
+			_, _ = c.Get("bad")
+
+			path := filepath.Join(t.TempDir(), "snapshot")
+			f, err := os.Create(path)
+			assert.NoError(t, err)
+			assert.NoError(t, c.Snapshot(f))
+			assert.NoError(t, f.Close())
+
+			// warm start
+			atomic.StoreInt32(&fetched, 0)
+			c2 := NewTypedAsyncCache(op).(*typedAsyncCache[string, int])
+			defer c2.Close()
+			c2.SetDefault("a", 100)
+			f, err = os.Open(path)
+			assert.NoError(t, err)
+			assert.NoError(t, c2.Restore(f))
+			assert.NoError(t, f.Close())
+
+			assert.Equal(t, map[string]int{"a": 100, "bb": 2}, c2.Dump())
+			v, meta, err := c2.GetWithMeta("bb")
+			assert.NoError(t, err)
+			assert.Equal(t, 2, v)
+			assert.True(t, meta.Stale)
+			assert.Equal(t, int32(0), atomic.LoadInt32(&fetched))
+
+			// refreshed on the next tick
+			c2.refresh()
+			assert.Equal(t, int32(2), atomic.LoadInt32(&fetched))
+			_, meta, _ = c2.GetWithMeta("bb")
+			assert.False(t, meta.Stale)
+		})
+	}
+}
+
+type upperCodec struct{}
+
+func (upperCodec) Encode(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bytes.ToUpper(b))
+	return err
+}
+
+func (upperCodec) Decode(r io.Reader, v interface{}) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes.ToLower(b), v)
+}
+
+func TestSnapshotCodec(t *testing.T) {
+	op := Options{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+		SnapshotCodec: upperCodec{},
+	}
+	c := NewAsyncCache(op)
+	defer c.Close()
+	_, _ = c.Get("key")
+
+	var buf bytes.Buffer
+	assert.NoError(t, c.(Snapshotter).Snapshot(&buf))
+	assert.Equal(t, `{"KEY":"KEY"}`, buf.String())
+
+	c2 := NewAsyncCache(op)
+	defer c2.Close()
+	assert.NoError(t, c2.(Snapshotter).Restore(&buf))
+	assert.Equal(t, map[string]interface{}{"key": "key"}, c2.Dump())
+
+	assert.Error(t, c2.(Snapshotter).Restore(strings.NewReader("{")))
+}
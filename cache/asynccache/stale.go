@@ -0,0 +1,85 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+const defaultMaxNegativeTTLFactor = 16
+
+// EntryMeta is the metadata of a cached entry.
+type EntryMeta struct {
+	// UpdatedAt is the time when the value was fetched or set.
+	UpdatedAt time.Time
+	// Stale is true if the latest refreshing of the entry failed,
+	// and the value is kept from an earlier fetch.
+	Stale bool
+}
+
+// GetWithMeta is like Get, and returns the metadata of the entry.
+// The metadata is zero if the entry is removed right after Get, e.g. evicted.
+func (c *typedAsyncCache[K, V]) GetWithMeta(key K) (val V, meta EntryMeta, err error) {
+	val, err = c.Get(key)
+	if v, ok := c.data.Load(key); ok {
+		e := v.(*entry[V])
+		meta.UpdatedAt = time.Unix(0, atomic.LoadInt64(&e.updatedAt))
+		meta.Stale = atomic.LoadInt32(&e.stale) == 1
+	}
+	return
+}
+
+// shouldRetry reports whether the negative TTL of an errored entry is over.
+func (c *typedAsyncCache[K, V]) shouldRetry(e *entry[V]) bool {
+	return c.opt.NegativeTTL > 0 && time.Now().UnixNano() >= atomic.LoadInt64(&e.retryAt)
+}
+
+// retry fetches an errored entry again, the concurrent retries are deduplicated.
+func (c *typedAsyncCache[K, V]) retry(ctx context.Context, key K, e *entry[V]) (V, error) {
+	return c.sfg.DoCtx(ctx, key, func() (V, error) {
+		if !c.shouldRetry(e) {
+			// retried by another caller in the meantime.
+			return e.Load(), e.err.Load()
+		}
+		v, hint, err := c.fetch(detachedContext{ctx}, key)
+		if err != nil {
+			e.err.Store(err)
+			c.setFailed(e, atomic.LoadInt32(&e.failures)+1)
+			return e.Load(), err
+		}
+		c.setHint(e, hint)
+		c.updateEntry(key, e, v)
+		return v, nil
+	})
+}
+
+// setFailed records the consecutive failures of an errored entry,
+// and backs off the time of its next retry.
+func (c *typedAsyncCache[K, V]) setFailed(e *entry[V], failures int32) {
+	atomic.StoreInt32(&e.failures, failures)
+	if c.opt.NegativeTTL == 0 {
+		return
+	}
+	ttl := c.opt.NegativeTTL
+	for i := int32(1); i < failures && ttl < c.opt.MaxNegativeTTL; i++ {
+		ttl *= 2
+	}
+	if ttl > c.opt.MaxNegativeTTL {
+		ttl = c.opt.MaxNegativeTTL
+	}
+	atomic.StoreInt64(&e.retryAt, time.Now().Add(ttl).UnixNano())
+}
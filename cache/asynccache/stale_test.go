@@ -0,0 +1,167 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxStaleness(t *testing.T) {
+	var fail int32
+	deleted := make(chan string, 1)
+	op := TypedOptions[string, string]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key string) (string, error) {
+			if atomic.LoadInt32(&fail) == 1 {
+				return "", errors.New("error")
+			}
+			return "val", nil
+		},
+		DeleteHandler: func(key string, oldData string) {
+			deleted <- oldData
+		},
+		MaxStaleness: 50 * time.Millisecond,
+	}
+	c := NewTypedAsyncCache(op).(*typedAsyncCache[string, string])
+	defer c.Close()
+
+	v, meta, err := c.GetWithMeta("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "val", v)
+	assert.False(t, meta.Stale)
+	assert.WithinDuration(t, time.Now(), meta.UpdatedAt, time.Second)
+
+	atomic.StoreInt32(&fail, 1)
+	c.refresh()
+	v, meta, err = c.GetWithMeta("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "val", v)
+	assert.True(t, meta.Stale)
+
+	time.Sleep(60 * time.Millisecond)
+	c.refresh()
+	assert.Equal(t, "val", <-deleted)
+	_, err = c.Get("key")
+	assert.Error(t, err)
+
+	atomic.StoreInt32(&fail, 0)
+	c.refresh()
+	v, meta, err = c.GetWithMeta("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "val", v)
+	assert.False(t, meta.Stale)
+}
+
+func TestNegativeTTL(t *testing.T) {
+	var fetched int32
+	fetch := func() (string, error) {
+		if atomic.AddInt32(&fetched, 1) <= 2 {
+			return "", errors.New("error")
+		}
+		return "val", nil
+	}
+	for _, tc := range []struct {
+		name string
+		op   TypedOptions[string, string]
+		get  func(c TypedAsyncCache[string, string]) (string, error)
+	}{
+		{
+			name: "Get",
+			op: TypedOptions[string, string]{
+				Fetcher: func(key string) (string, error) {
+					return fetch()
+				},
+			},
+			get: func(c TypedAsyncCache[string, string]) (string, error) {
+				return c.Get("key")
+			},
+		},
+		{
+			name: "MGet",
+			op: TypedOptions[string, string]{
+				BatchFetcher: func(keys []string) (map[string]string, map[string]error) {
+					v, err := fetch()
+					if err != nil {
+						return nil, map[string]error{"key": err}
+					}
+					return map[string]string{"key": v}, nil
+				},
+			},
+			get: func(c TypedAsyncCache[string, string]) (string, error) {
+				vals, errs := c.(BatchGetter[string, string]).MGet("key")
+				return vals["key"], errs["key"]
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			atomic.StoreInt32(&fetched, 0)
+			tc.op.RefreshDuration = time.Minute
+			tc.op.NegativeTTL = 40 * time.Millisecond
+			c := NewTypedAsyncCache(tc.op)
+			defer c.Close()
+
+			_, err := tc.get(c)
+			assert.Error(t, err)
+			_, err = tc.get(c)
+			assert.Error(t, err)
+			assert.Equal(t, int32(1), atomic.LoadInt32(&fetched))
+
+			time.Sleep(50 * time.Millisecond)
+			_, err = tc.get(c)
+			assert.Error(t, err)
+			assert.Equal(t, int32(2), atomic.LoadInt32(&fetched))
+
+			// backoff to 80ms after the second failure
+			time.Sleep(50 * time.Millisecond)
+			_, err = tc.get(c)
+			assert.Error(t, err)
+			assert.Equal(t, int32(2), atomic.LoadInt32(&fetched))
+
+			time.Sleep(40 * time.Millisecond)
+			v, err := tc.get(c)
+			assert.NoError(t, err)
+			assert.Equal(t, "val", v)
+			assert.Equal(t, int32(3), atomic.LoadInt32(&fetched))
+		})
+	}
+}
+
+func TestGetOrSetReportsError(t *testing.T) {
+	reported := make(chan error, 2)
+	op := TypedOptions[string, string]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key string) (string, error) {
+			return "", errors.New("error")
+		},
+		ErrorHandler: func(key string, err error) {
+			reported <- err
+		},
+	}
+	c := NewTypedAsyncCache(op)
+	defer c.Close()
+
+	assert.Equal(t, "def", c.GetOrSet("key", "def"))
+	assert.Error(t, <-reported)
+
+	_, err := c.Get("errored")
+	assert.Error(t, err)
+	assert.Equal(t, "def", c.GetOrSet("errored", "def"))
+	assert.Error(t, <-reported)
+}
@@ -0,0 +1,152 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/gopkg/internal/counter"
+)
+
+// Stats is the statistics of a cache.
+type Stats struct {
+	// Hits and Misses count the gets of keys,
+	// a get of an errored entry to be fetched again is a miss.
+	Hits   uint64
+	Misses uint64
+	// Loads counts the fetched keys, LoadErrors counts the failed ones,
+	// and LoadDuration is the total time spent in the fetchers.
+	Loads        uint64
+	LoadErrors   uint64
+	LoadDuration time.Duration
+	// RefreshCycles counts the refresh cycles, RefreshOverruns counts the ones
+	// longer than RefreshTick, and LastRefreshDuration is the duration of the latest one.
+	RefreshCycles       uint64
+	RefreshOverruns     uint64
+	LastRefreshDuration time.Duration
+	// L2Hits counts the keys found in the L2Store instead of being fetched.
+	L2Hits uint64
+	// Evictions counts the entries evicted because of MaxEntries or MaxBytes.
+	Evictions uint64
+	// Size is the number of cached entries.
+	Size int
+}
+
+// HitRatio returns Hits / (Hits + Misses), or 0 if there is no get.
+func (s Stats) HitRatio() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// StatsReporter is notified of the events of a cache,
+// it can be implemented to bridge the statistics to a metrics system.
+// The methods are called synchronously, so they should be fast.
+type StatsReporter interface {
+	// ReportHit is called on each hit.
+	ReportHit()
+	// ReportMiss is called on each miss.
+	ReportMiss()
+	// ReportLoad is called after each call of the fetcher, in which n keys were fetched
+	// and errs of them failed. n is greater than 1 only for BatchFetcher.
+	ReportLoad(n, errs int, duration time.Duration)
+	// ReportRefreshCycle is called after each refresh cycle.
+	ReportRefreshCycle(duration time.Duration, overrun bool)
+	// ReportEviction is called when n entries are evicted.
+	ReportEviction(n int)
+}
+
+// cacheStats counts the events of a cache, the counters of gets are
+// per-P to keep the hot path free of contention.
+type cacheStats struct {
+	// the 64-bit atomic fields are kept first to be aligned on 32-bit platforms.
+	loads               int64
+	loadErrors          int64
+	loadDuration        int64
+	refreshCycles       int64
+	refreshOverruns     int64
+	lastRefreshDuration int64
+	l2Hits              int64
+
+	reporter StatsReporter
+
+	hits   counter.PerP
+	misses counter.PerP
+}
+
+func newCacheStats(reporter StatsReporter) cacheStats {
+	return cacheStats{
+		reporter: reporter,
+		hits:     counter.NewPerP(),
+		misses:   counter.NewPerP(),
+	}
+}
+
+func (s *cacheStats) recordHit() {
+	s.hits.Add(1)
+	if s.reporter != nil {
+		s.reporter.ReportHit()
+	}
+}
+
+func (s *cacheStats) recordMiss() {
+	s.misses.Add(1)
+	if s.reporter != nil {
+		s.reporter.ReportMiss()
+	}
+}
+
+func (s *cacheStats) recordLoad(n, errs int, d time.Duration) {
+	atomic.AddInt64(&s.loads, int64(n))
+	atomic.AddInt64(&s.loadErrors, int64(errs))
+	atomic.AddInt64(&s.loadDuration, int64(d))
+	if s.reporter != nil {
+		s.reporter.ReportLoad(n, errs, d)
+	}
+}
+
+func (s *cacheStats) recordRefreshCycle(d time.Duration, overrun bool) {
+	atomic.AddInt64(&s.refreshCycles, 1)
+	if overrun {
+		atomic.AddInt64(&s.refreshOverruns, 1)
+	}
+	atomic.StoreInt64(&s.lastRefreshDuration, int64(d))
+	if s.reporter != nil {
+		s.reporter.ReportRefreshCycle(d, overrun)
+	}
+}
+
+// Stats returns the statistics of the cache.
+func (c *typedAsyncCache[K, V]) Stats() Stats {
+	s := &c.stats
+	st := Stats{
+		Hits:                uint64(s.hits.Get()),
+		Misses:              uint64(s.misses.Get()),
+		Loads:               uint64(atomic.LoadInt64(&s.loads)),
+		LoadErrors:          uint64(atomic.LoadInt64(&s.loadErrors)),
+		LoadDuration:        time.Duration(atomic.LoadInt64(&s.loadDuration)),
+		RefreshCycles:       uint64(atomic.LoadInt64(&s.refreshCycles)),
+		RefreshOverruns:     uint64(atomic.LoadInt64(&s.refreshOverruns)),
+		LastRefreshDuration: time.Duration(atomic.LoadInt64(&s.lastRefreshDuration)),
+		L2Hits:              uint64(atomic.LoadInt64(&s.l2Hits)),
+		Evictions:           c.evictionCount(),
+	}
+	c.evictMu.Lock()
+	st.Size = c.entries
+	c.evictMu.Unlock()
+	return st
+}
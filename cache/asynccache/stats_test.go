@@ -0,0 +1,133 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testReporter struct {
+	sync.Mutex
+	hits, misses, loads, loadErrs, cycles, evictions int
+}
+
+func (r *testReporter) ReportHit() {
+	r.Lock()
+	r.hits++
+	r.Unlock()
+}
+
+func (r *testReporter) ReportMiss() {
+	r.Lock()
+	r.misses++
+	r.Unlock()
+}
+
+func (r *testReporter) ReportLoad(n, errs int, duration time.Duration) {
+	r.Lock()
+	r.loads += n
+	r.loadErrs += errs
+	r.Unlock()
+}
+
+func (r *testReporter) ReportRefreshCycle(duration time.Duration, overrun bool) {
+	r.Lock()
+	r.cycles++
+	r.Unlock()
+}
+
+func (r *testReporter) ReportEviction(n int) {
+	r.Lock()
+	r.evictions += n
+	r.Unlock()
+}
+
+func TestStats(t *testing.T) {
+	reporter := &testReporter{}
+	op := TypedOptions[int, int]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key int) (int, error) {
+			if key < 0 {
+				return 0, errors.New("error")
+			}
+			time.Sleep(time.Millisecond)
+			return key, nil
+		},
+		MaxEntries:    3,
+		StatsReporter: reporter,
+	}
+	c := NewTypedAsyncCache(op).(*typedAsyncCache[int, int])
+	defer c.Close()
+
+	_, _ = c.Get(1)
+	_, _ = c.Get(1)
+	_, _ = c.Get(-1)
+	_ = c.GetOrSet(2, 0)
+	_ = c.GetOrSet(2, 0)
+	c.MGet(1, 2, 3) // 3 is a miss and evicts -1
+	c.refresh()
+
+	st := c.Stats()
+	assert.Equal(t, uint64(4), st.Hits)
+	assert.Equal(t, uint64(4), st.Misses)
+	assert.Equal(t, 0.5, st.HitRatio())
+	assert.Equal(t, uint64(4+3), st.Loads)
+	assert.Equal(t, uint64(1), st.LoadErrors)
+	assert.GreaterOrEqual(t, st.LoadDuration, 5*time.Millisecond)
+	assert.Equal(t, uint64(1), st.RefreshCycles)
+	assert.Equal(t, uint64(0), st.RefreshOverruns)
+	assert.Greater(t, st.LastRefreshDuration, time.Duration(0))
+	assert.Equal(t, uint64(1), st.Evictions)
+	assert.Equal(t, 3, st.Size)
+
+	reporter.Lock()
+	defer reporter.Unlock()
+	assert.Equal(t, 4, reporter.hits)
+	assert.Equal(t, 4, reporter.misses)
+	assert.Equal(t, 7, reporter.loads)
+	assert.Equal(t, 1, reporter.loadErrs)
+	assert.Equal(t, 1, reporter.cycles)
+	assert.Equal(t, 1, reporter.evictions)
+}
+
+func TestStatsSize(t *testing.T) {
+	op := TypedOptions[int, int]{
+		RefreshDuration: time.Minute,
+		Fetcher: func(key int) (int, error) {
+			return key, nil
+		},
+	}
+	c := NewTypedAsyncCache(op).(*typedAsyncCache[int, int])
+	defer c.Close()
+
+	for i := 0; i < 10; i++ {
+		_, _ = c.Get(i)
+	}
+	c.SetDefault(10, 10)
+	c.SetDefault(10, 10)
+	_, _ = c.Refresh(1) // replaces an entry
+	assert.Equal(t, 11, c.Stats().Size)
+
+	c.Invalidate(0)
+	c.Invalidate(0)
+	c.DeleteIf(func(key int) bool { return key >= 5 })
+	assert.Equal(t, 4, c.Stats().Size)
+	assert.Len(t, c.Dump(), 4)
+}
@@ -0,0 +1,195 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/bytedance/gopkg/collection/skipmap"
+	"github.com/bytedance/gopkg/util/xxhash3"
+)
+
+// Storage stores the entries of a cache, it must be safe for concurrent use.
+// The values are opaque to the storage.
+type Storage[K comparable] interface {
+	Load(key K) (value interface{}, ok bool)
+	Store(key K, value interface{})
+	LoadOrStore(key K, value interface{}) (actual interface{}, loaded bool)
+	Delete(key K)
+	// Range calls f for each key and value like sync.Map.Range,
+	// f may modify the storage.
+	Range(f func(key K, value interface{}) bool)
+}
+
+// NewSyncMapStorage creates a Storage based on sync.Map, it is the default storage.
+func NewSyncMapStorage[K comparable]() Storage[K] {
+	return &syncMapStorage[K]{}
+}
+
+type syncMapStorage[K comparable] struct {
+	m sync.Map
+}
+
+func (s *syncMapStorage[K]) Load(key K) (interface{}, bool) {
+	return s.m.Load(key)
+}
+
+func (s *syncMapStorage[K]) Store(key K, value interface{}) {
+	s.m.Store(key, value)
+}
+
+func (s *syncMapStorage[K]) LoadOrStore(key K, value interface{}) (interface{}, bool) {
+	return s.m.LoadOrStore(key, value)
+}
+
+func (s *syncMapStorage[K]) Delete(key K) {
+	s.m.Delete(key)
+}
+
+func (s *syncMapStorage[K]) Range(f func(key K, value interface{}) bool) {
+	s.m.Range(func(key, value interface{}) bool {
+		return f(key.(K), value)
+	})
+}
+
+// NewShardedStorage creates a Storage which shards the keys by hash into maps guarded by their own locks,
+// it avoids the expensive promotions of sync.Map under write-heavy workloads.
+// shards is rounded up to a power of 2, and defaults to 4 * GOMAXPROCS if not positive.
+func NewShardedStorage[K comparable](shards int, hash func(key K) uint64) Storage[K] {
+	if shards <= 0 {
+		shards = 4 * runtime.GOMAXPROCS(0)
+	}
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+	s := &shardedStorage[K]{
+		shards: make([]storageShard[K], n),
+		mask:   uint64(n - 1),
+		hash:   hash,
+	}
+	for i := range s.shards {
+		s.shards[i].m = make(map[K]interface{})
+	}
+	return s
+}
+
+// NewStringShardedStorage creates a sharded Storage for string keys hashed by xxhash3.
+func NewStringShardedStorage(shards int) Storage[string] {
+	return NewShardedStorage(shards, xxhash3.HashString)
+}
+
+const cacheLineSize = 64
+
+type storageShard[K comparable] struct {
+	sync.RWMutex
+	m map[K]interface{}
+	_ [cacheLineSize]byte // avoid false sharing between shards
+}
+
+type shardedStorage[K comparable] struct {
+	shards []storageShard[K]
+	mask   uint64
+	hash   func(key K) uint64
+}
+
+func (s *shardedStorage[K]) shard(key K) *storageShard[K] {
+	return &s.shards[s.hash(key)&s.mask]
+}
+
+func (s *shardedStorage[K]) Load(key K) (value interface{}, ok bool) {
+	sh := s.shard(key)
+	sh.RLock()
+	value, ok = sh.m[key]
+	sh.RUnlock()
+	return
+}
+
+func (s *shardedStorage[K]) Store(key K, value interface{}) {
+	sh := s.shard(key)
+	sh.Lock()
+	sh.m[key] = value
+	sh.Unlock()
+}
+
+func (s *shardedStorage[K]) LoadOrStore(key K, value interface{}) (actual interface{}, loaded bool) {
+	sh := s.shard(key)
+	sh.Lock()
+	defer sh.Unlock()
+	if actual, loaded = sh.m[key]; loaded {
+		return actual, true
+	}
+	sh.m[key] = value
+	return value, false
+}
+
+func (s *shardedStorage[K]) Delete(key K) {
+	sh := s.shard(key)
+	sh.Lock()
+	delete(sh.m, key)
+	sh.Unlock()
+}
+
+// Range iterates a copy of each shard, so that f can modify the storage.
+func (s *shardedStorage[K]) Range(f func(key K, value interface{}) bool) {
+	var keys []K
+	var values []interface{}
+	for i := range s.shards {
+		sh := &s.shards[i]
+		keys, values = keys[:0], values[:0]
+		sh.RLock()
+		for k, v := range sh.m {
+			keys = append(keys, k)
+			values = append(values, v)
+		}
+		sh.RUnlock()
+		for j := range keys {
+			if !f(keys[j], values[j]) {
+				return
+			}
+		}
+	}
+}
+
+// NewSkipMapStorage creates a Storage for string keys based on skipmap.StringMap,
+// whose reads are lock-free.
+func NewSkipMapStorage() Storage[string] {
+	return &skipMapStorage{m: skipmap.NewString()}
+}
+
+type skipMapStorage struct {
+	m *skipmap.StringMap
+}
+
+func (s *skipMapStorage) Load(key string) (interface{}, bool) {
+	return s.m.Load(key)
+}
+
+func (s *skipMapStorage) Store(key string, value interface{}) {
+	s.m.Store(key, value)
+}
+
+func (s *skipMapStorage) LoadOrStore(key string, value interface{}) (interface{}, bool) {
+	return s.m.LoadOrStore(key, value)
+}
+
+func (s *skipMapStorage) Delete(key string) {
+	s.m.Delete(key)
+}
+
+func (s *skipMapStorage) Range(f func(key string, value interface{}) bool) {
+	s.m.Range(f)
+}
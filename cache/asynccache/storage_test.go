@@ -0,0 +1,176 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bytedance/gopkg/lang/fastrand"
+	"github.com/stretchr/testify/assert"
+)
+
+var storages = map[string]func() Storage[string]{
+	"syncmap": NewSyncMapStorage[string],
+	"sharded": func() Storage[string] { return NewStringShardedStorage(0) },
+	"skipmap": NewSkipMapStorage,
+}
+
+func TestStorage(t *testing.T) {
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			s := newStorage()
+			_, ok := s.Load("a")
+			assert.False(t, ok)
+
+			s.Store("a", 1)
+			v, ok := s.Load("a")
+			assert.True(t, ok)
+			assert.Equal(t, 1, v)
+
+			v, loaded := s.LoadOrStore("a", 2)
+			assert.True(t, loaded)
+			assert.Equal(t, 1, v)
+			v, loaded = s.LoadOrStore("b", 2)
+			assert.False(t, loaded)
+			assert.Equal(t, 2, v)
+
+			for i := 0; i < 100; i++ {
+				s.Store(strconv.Itoa(i), i)
+			}
+			// deleting in Range is allowed
+			n := 0
+			s.Range(func(key string, value interface{}) bool {
+				n++
+				s.Delete(key)
+				return true
+			})
+			assert.Equal(t, 102, n)
+			s.Range(func(key string, value interface{}) bool {
+				t.Fatal("not empty")
+				return false
+			})
+		})
+	}
+}
+
+func TestCacheWithStorage(t *testing.T) {
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			op := TypedOptions[string, string]{
+				RefreshDuration: time.Minute,
+				Fetcher: func(key string) (string, error) {
+					return key, nil
+				},
+				MaxEntries: 10,
+				NewStorage: newStorage,
+			}
+			c := newTypedAsyncCache(op)
+			defer c.Close()
+
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						key := strconv.Itoa(j % 20)
+						v, err := c.Get(key)
+						assert.NoError(t, err)
+						assert.Equal(t, key, v)
+					}
+				}()
+			}
+			wg.Wait()
+			assert.Len(t, c.Dump(), 10)
+			assert.Equal(t, 10, c.Stats().Size)
+		})
+	}
+}
+
+func BenchmarkStorage(b *testing.B) {
+	const keys = 1 << 14
+	for name, newStorage := range storages {
+		b.Run(name, func(b *testing.B) {
+			s := newStorage()
+			for i := 0; i < keys; i++ {
+				s.Store(strconv.Itoa(i), i)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					key := strconv.Itoa(fastrand.Intn(keys))
+					if fastrand.Intn(10) == 0 {
+						s.Store(key, 0)
+					} else {
+						s.Load(key)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkStorageMixed benchmarks the cache with 80% hits, 10% misses and 10% writes,
+// while the entries are refreshed continuously.
+func BenchmarkStorageMixed(b *testing.B) {
+	const keys = 1 << 14
+	for name, newStorage := range storages {
+		b.Run(name, func(b *testing.B) {
+			op := TypedOptions[string, int]{
+				RefreshDuration: time.Minute,
+				Fetcher: func(key string) (int, error) {
+					return len(key), nil
+				},
+				NewStorage: newStorage,
+			}
+			c := NewTypedAsyncCache(op).(*typedAsyncCache[string, int])
+			defer c.Close()
+			for i := 0; i < keys; i++ {
+				c.SetDefault(strconv.Itoa(i), i)
+			}
+
+			var stop int32
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for atomic.LoadInt32(&stop) == 0 {
+					c.refresh()
+				}
+			}()
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					switch n := fastrand.Intn(10); n {
+					case 0:
+						_, _ = c.Get(strconv.Itoa(keys + fastrand.Intn(keys)))
+					case 1:
+						key := strconv.Itoa(fastrand.Intn(keys))
+						c.storeEntry(key, c.newEntry(n, nil, FetchHint{}))
+					default:
+						_, _ = c.Get(strconv.Itoa(fastrand.Intn(keys)))
+					}
+				}
+			})
+			b.StopTimer()
+			atomic.StoreInt32(&stop, 1)
+			<-done
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import "sync"
+
+const wheelSlots = 256
+
+type wheelItem[K comparable] struct {
+	key K
+	seq uint64 // the item is stale if it doesn't match the seq of the entry
+	due uint64 // the tick when the item is due
+}
+
+// timingWheel is a hashed timing wheel which schedules the refreshing of entries,
+// so that only the due entries are visited on each tick.
+// An item due in more than wheelSlots ticks is kept in its slot for several rounds.
+type timingWheel[K comparable] struct {
+	mu    sync.Mutex
+	now   uint64 // ticks elapsed
+	slots [wheelSlots][]wheelItem[K]
+}
+
+// schedule schedules key to be due after the given ticks, which must be positive.
+func (w *timingWheel[K]) schedule(key K, seq, ticks uint64) {
+	w.mu.Lock()
+	due := w.now + ticks
+	slot := &w.slots[due%wheelSlots]
+	*slot = append(*slot, wheelItem[K]{key: key, seq: seq, due: due})
+	w.mu.Unlock()
+}
+
+// advance moves the wheel forward by one tick and returns the due items.
+func (w *timingWheel[K]) advance() (due []wheelItem[K]) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.now++
+	slot := &w.slots[w.now%wheelSlots]
+	items := *slot
+	n := 0
+	for _, it := range items {
+		if it.due <= w.now {
+			due = append(due, it)
+			continue
+		}
+		// due in a later round.
+		items[n] = it
+		n++
+	}
+	var zero wheelItem[K]
+	for i := n; i < len(items); i++ {
+		items[i] = zero // release the keys
+	}
+	*slot = items[:n]
+	return due
+}
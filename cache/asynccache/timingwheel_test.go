@@ -0,0 +1,104 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asynccache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimingWheel(t *testing.T) {
+	var w timingWheel[string]
+	w.schedule("a", 1, 1)
+	w.schedule("b", 2, 3)
+	w.schedule("c", 3, wheelSlots+1) // same slot as a, but in the next round
+
+	due := w.advance()
+	assert.Equal(t, []wheelItem[string]{{key: "a", seq: 1, due: 1}}, due)
+	assert.Empty(t, w.advance())
+	assert.Equal(t, "b", w.advance()[0].key)
+	for i := 3; i < wheelSlots; i++ {
+		assert.Empty(t, w.advance())
+	}
+	due = w.advance()
+	assert.Len(t, due, 1)
+	assert.Equal(t, "c", due[0].key)
+}
+
+func TestHintFetcher(t *testing.T) {
+	var mu sync.Mutex
+	fetched := make(map[string]int)
+	op := TypedOptions[string, int]{
+		RefreshDuration: 10 * time.Minute,
+		RefreshTick:     time.Minute,
+		HintFetcher: func(key string) (int, FetchHint, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			fetched[key]++
+			if key == "fast" {
+				return fetched[key], FetchHint{Refresh: time.Minute}, nil
+			}
+			return fetched[key], FetchHint{}, nil
+		},
+	}
+	c := NewTypedAsyncCache(op).(*typedAsyncCache[string, int])
+	defer c.Close()
+
+	_, _ = c.Get("fast")
+	_, _ = c.Get("slow")
+	c.SetDefault("default", 0)
+	for i := 0; i < 10; i++ {
+		c.refresh()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]int{"fast": 11, "slow": 2, "default": 1}, fetched)
+	assert.Equal(t, map[string]int{"fast": 11, "slow": 2, "default": 1}, c.Dump())
+}
+
+func TestHintExpire(t *testing.T) {
+	op := TypedOptions[string, string]{
+		RefreshDuration: time.Minute,
+		EnableExpire:    true,
+		ExpireDuration:  time.Minute,
+		HintFetcher: func(key string) (string, FetchHint, error) {
+			if key == "long" {
+				return key, FetchHint{Expire: 150 * time.Second}, nil
+			}
+			return key, FetchHint{}, nil
+		},
+	}
+	c := NewTypedAsyncCache(op).(*typedAsyncCache[string, string])
+	defer c.Close()
+
+	_, _ = c.Get("long")
+	_, _ = c.Get("short")
+	c.expire()
+	c.expire()
+	assert.Equal(t, map[string]string{"long": "long"}, c.Dump())
+
+	// an access resets the idle ticks.
+	_, _ = c.Get("long")
+	c.expire()
+	c.expire()
+	c.expire()
+	assert.Len(t, c.Dump(), 1)
+	c.expire()
+	assert.Empty(t, c.Dump())
+}
@@ -15,10 +15,7 @@
 package circuitbreaker
 
 import (
-	"runtime"
 	"sync/atomic"
-
-	"github.com/bytedance/gopkg/internal/runtimex"
 )
 
 type Counter interface {
@@ -42,46 +39,3 @@ func (c *atomicCounter) Get() int64 {
 func (c *atomicCounter) Zero() {
 	atomic.StoreInt64(&c.x, 0)
 }
-
-const (
-	cacheLineSize = 64
-)
-
-var (
-	countersLen int
-)
-
-func init() {
-	countersLen = runtime.GOMAXPROCS(0)
-}
-
-type counterShard struct {
-	x int64
-	_ [cacheLineSize - 8]byte
-}
-
-type perPCounter []counterShard
-
-func newPerPCounter() perPCounter {
-	return make([]counterShard, countersLen)
-}
-
-func (c perPCounter) Add(i int64) {
-	tid := runtimex.Pid()
-	atomic.AddInt64(&c[tid%countersLen].x, i)
-}
-
-// Get is not precise, but it's ok in this scenario.
-func (c perPCounter) Get() int64 {
-	var n int64
-	for i := range c {
-		n += atomic.LoadInt64(&c[i].x)
-	}
-	return n
-}
-
-func (c perPCounter) Zero() {
-	for i := range c {
-		atomic.StoreInt64(&c[i].x, 0)
-	}
-}
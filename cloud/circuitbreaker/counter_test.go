@@ -17,6 +17,8 @@ package circuitbreaker
 import (
 	"sync"
 	"testing"
+
+	"github.com/bytedance/gopkg/internal/counter"
 )
 
 func BenchmarkAtomicCounter_Add(b *testing.B) {
@@ -30,7 +32,7 @@ func BenchmarkAtomicCounter_Add(b *testing.B) {
 }
 
 func BenchmarkPerPCounter_Add(b *testing.B) {
-	c := newPerPCounter()
+	c := counter.NewPerP()
 	b.SetParallelism(1000)
 	b.RunParallel(func(p *testing.PB) {
 		for p.Next() {
@@ -42,7 +44,7 @@ func BenchmarkPerPCounter_Add(b *testing.B) {
 func TestPerPCounter(t *testing.T) {
 	numPerG := 1000
 	numG := 1000
-	c := newPerPCounter()
+	c := counter.NewPerP()
 	c1 := atomicCounter{}
 	var wg sync.WaitGroup
 	wg.Add(numG)
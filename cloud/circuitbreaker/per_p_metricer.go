@@ -19,19 +19,20 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/bytedance/gopkg/internal/counter"
 	"github.com/bytedance/gopkg/lang/syncx"
 )
 
 // perPBucket holds counts of failures and successes
 type perPBucket struct {
 	failure        int64
-	successCounter perPCounter
+	successCounter counter.PerP
 	timeout        int64
 }
 
 func newPerPBucket() perPBucket {
 	return perPBucket{
-		successCounter: newPerPCounter(),
+		successCounter: counter.NewPerP(),
 	}
 }
 
@@ -78,7 +79,7 @@ type perPWindow struct {
 	bucketNums int32         // the numbe of buckets
 	inWindow   int32         // the number of buckets in the perPWindow
 
-	allSuccessCounter perPCounter
+	allSuccessCounter counter.PerP
 	allFailure        int64
 	allTimeout        int64
 
@@ -100,7 +101,7 @@ func newPerPWindowWithOptions(bucketTime time.Duration, bucketNums int32) (metri
 
 	w := new(perPWindow)
 	w.rw = syncx.NewRWMutex()
-	w.allSuccessCounter = newPerPCounter()
+	w.allSuccessCounter = counter.NewPerP()
 	w.bucketNums = bucketNums
 	w.bucketTime = bucketTime
 	w.buckets = make([]perPBucket, w.bucketNums)
@@ -5,7 +5,6 @@ go 1.18
 require (
 	github.com/stretchr/testify v1.9.0
 	golang.org/x/net v0.24.0
-	golang.org/x/sync v0.8.0
 	golang.org/x/sys v0.19.0
 )
 
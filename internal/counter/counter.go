@@ -0,0 +1,70 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package counter provides a counter sharded by P.
+package counter
+
+import (
+	"runtime"
+	"sync/atomic"
+
+	"github.com/bytedance/gopkg/internal/runtimex"
+)
+
+const (
+	cacheLineSize = 64
+)
+
+var (
+	countersLen int
+)
+
+func init() {
+	countersLen = runtime.GOMAXPROCS(0)
+}
+
+type counterShard struct {
+	x int64
+	_ [cacheLineSize - 8]byte
+}
+
+// PerP is a counter sharded by P to avoid contention on the hot path.
+type PerP []counterShard
+
+// NewPerP creates a PerP counter.
+func NewPerP() PerP {
+	return make([]counterShard, countersLen)
+}
+
+// Add adds i to the counter.
+func (c PerP) Add(i int64) {
+	tid := runtimex.Pid()
+	atomic.AddInt64(&c[tid%countersLen].x, i)
+}
+
+// Get returns the sum of the shards, it is not precise while the counter is being added.
+func (c PerP) Get() int64 {
+	var n int64
+	for i := range c {
+		n += atomic.LoadInt64(&c[i].x)
+	}
+	return n
+}
+
+// Zero resets the counter.
+func (c PerP) Zero() {
+	for i := range c {
+		atomic.StoreInt64(&c[i].x, 0)
+	}
+}
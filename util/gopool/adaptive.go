@@ -0,0 +1,174 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultAdaptiveInterval = 100 * time.Millisecond
+	defaultAdaptiveBackoff  = 0.75
+)
+
+// Clock provides the current time, it's replaced by a fake one in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// AdaptiveScaling configures the adaptive scaling of a pool, which adjusts the effective cap of the pool
+// by AIMD from the observed wait time and throughput of tasks.
+//
+// At the end of each Interval, if the mean wait time of the tasks started in it is longer than TargetWaitTime,
+// the effective cap is increased by Increase, unless it was increased at the end of the last interval but
+// the throughput didn't grow, which means more workers don't help, e.g. a downstream is saturated,
+// in which case the effective cap is multiplied by Backoff.
+//
+// The effective cap starts at the cap of the pool, so a pool doesn't start cold, and it's backed off
+// only after the throughput stops growing. Raising it starts the workers for the queued tasks.
+type AdaptiveScaling struct {
+	// TargetWaitTime is the target of the mean wait time of tasks.
+	TargetWaitTime time.Duration
+	// Interval is the interval between adjustments, defaults to 100ms.
+	Interval time.Duration
+	// MinCap is the minimum effective cap, defaults to 1.
+	MinCap int32
+	// Increase is added to the effective cap on increasing, defaults to 1.
+	Increase int32
+	// Backoff multiplies the effective cap on decreasing, defaults to 0.75.
+	Backoff float64
+	// Clock defaults to the system clock.
+	Clock Clock
+}
+
+// adaptiveLimiter limits the number of workers by AdaptiveScaling.
+type adaptiveLimiter struct {
+	// the 64-bit atomic fields are kept first to be aligned on 32-bit platforms.
+	// the observations in the current interval
+	intervalStart int64 // unix nano
+	waitSum       int64
+	started       int64
+	completed     int64
+
+	opt   AdaptiveScaling
+	limit int32
+
+	mu             sync.Mutex // serializes adjusting
+	lastThroughput float64
+	increased      bool
+}
+
+// newAdaptiveLimiter returns a limiter whose limit starts at cap.
+func newAdaptiveLimiter(opt AdaptiveScaling, cap int32) *adaptiveLimiter {
+	if opt.Interval <= 0 {
+		opt.Interval = defaultAdaptiveInterval
+	}
+	if opt.MinCap <= 0 {
+		opt.MinCap = 1
+	}
+	if opt.Increase <= 0 {
+		opt.Increase = 1
+	}
+	if opt.Backoff <= 0 || opt.Backoff >= 1 {
+		opt.Backoff = defaultAdaptiveBackoff
+	}
+	if opt.Clock == nil {
+		opt.Clock = systemClock{}
+	}
+	if cap < opt.MinCap {
+		cap = opt.MinCap
+	}
+	return &adaptiveLimiter{
+		opt:           opt,
+		limit:         cap,
+		intervalStart: opt.Clock.Now().UnixNano(),
+	}
+}
+
+// Limit returns the current effective cap.
+func (l *adaptiveLimiter) Limit() int32 {
+	return atomic.LoadInt32(&l.limit)
+}
+
+// onStart observes a task started at now after waiting, and adjusts the limit
+// at the end of the interval, the limit doesn't exceed maxCap.
+// It returns true if the limit is raised.
+func (l *adaptiveLimiter) onStart(now time.Time, wait time.Duration, maxCap int32) bool {
+	atomic.AddInt64(&l.waitSum, int64(wait))
+	atomic.AddInt64(&l.started, 1)
+	if now.UnixNano()-atomic.LoadInt64(&l.intervalStart) >= int64(l.opt.Interval) {
+		return l.adjust(now, maxCap)
+	}
+	return false
+}
+
+// onDone observes a task done.
+func (l *adaptiveLimiter) onDone() {
+	atomic.AddInt64(&l.completed, 1)
+}
+
+func (l *adaptiveLimiter) adjust(now time.Time, maxCap int32) bool {
+	if !l.mu.TryLock() {
+		// being adjusted by another worker
+		return false
+	}
+	defer l.mu.Unlock()
+	elapsed := now.UnixNano() - atomic.LoadInt64(&l.intervalStart)
+	if elapsed < int64(l.opt.Interval) {
+		return false
+	}
+	atomic.StoreInt64(&l.intervalStart, now.UnixNano())
+	waitSum := atomic.SwapInt64(&l.waitSum, 0)
+	started := atomic.SwapInt64(&l.started, 0)
+	completed := atomic.SwapInt64(&l.completed, 0)
+	if started == 0 {
+		return false
+	}
+
+	throughput := float64(completed) / float64(elapsed)
+	old := atomic.LoadInt32(&l.limit)
+	limit := old
+	if time.Duration(waitSum/started) > l.opt.TargetWaitTime {
+		if l.increased && throughput <= l.lastThroughput {
+			limit = int32(float64(limit) * l.opt.Backoff)
+			l.increased = false
+		} else if limit > maxCap-l.opt.Increase {
+			limit = maxCap
+			l.increased = true
+		} else {
+			limit += l.opt.Increase
+			l.increased = true
+		}
+	} else {
+		l.increased = false
+	}
+	if limit > maxCap {
+		limit = maxCap
+	}
+	if limit < l.opt.MinCap {
+		limit = l.opt.MinCap
+	}
+	l.lastThroughput = throughput
+	atomic.StoreInt32(&l.limit, limit)
+	return limit > old
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	clock := newFakeClock()
+	l := newAdaptiveLimiter(AdaptiveScaling{
+		TargetWaitTime: 10 * time.Millisecond,
+		Interval:       time.Second,
+		MinCap:         2,
+		Backoff:        0.5,
+		Clock:          clock,
+	}, 2)
+	// runs an interval where n tasks are done after waiting
+	interval := func(n int, wait time.Duration) int32 {
+		for i := 0; i < n; i++ {
+			l.onStart(clock.Now(), wait, 100)
+			l.onDone()
+		}
+		clock.Advance(time.Second)
+		l.onStart(clock.Now(), wait, 100)
+		return l.Limit()
+	}
+
+	if limit := l.Limit(); limit != 2 {
+		t.Error(limit)
+	}
+	// waiting too long, increases while the throughput grows
+	if limit := interval(10, 20*time.Millisecond); limit != 3 {
+		t.Error(limit)
+	}
+	if limit := interval(20, 20*time.Millisecond); limit != 4 {
+		t.Error(limit)
+	}
+	// the throughput doesn't grow, backs off
+	if limit := interval(19, 20*time.Millisecond); limit != 2 {
+		t.Error(limit)
+	}
+	// increases again
+	if limit := interval(19, 20*time.Millisecond); limit != 3 {
+		t.Error(limit)
+	}
+	// not waiting too long, unchanged
+	if limit := interval(19, time.Millisecond); limit != 3 {
+		t.Error(limit)
+	}
+	// not adjusted within the interval
+	clock.Advance(time.Second / 2)
+	l.onStart(clock.Now(), time.Second, 100)
+	if limit := l.Limit(); limit != 3 {
+		t.Error(limit)
+	}
+	// bounded by the cap
+	clock.Advance(time.Second)
+	l.onStart(clock.Now(), time.Second, 2)
+	if limit := l.Limit(); limit != 2 {
+		t.Error(limit)
+	}
+}
+
+func TestPoolAdaptiveScaling(t *testing.T) {
+	clock := newFakeClock()
+	config := NewConfig()
+	config.AdaptiveScaling = &AdaptiveScaling{
+		TargetWaitTime: time.Millisecond,
+		Interval:       time.Second,
+		Clock:          clock,
+	}
+	p := NewPool("test", 10, config).(*pool)
+	// starts at the cap
+	if m := p.Metrics(); m.Cap != 10 || m.EffectiveCap != 10 {
+		t.Error(m.Cap, m.EffectiveCap)
+	}
+	// backed off to 1
+	atomic.StoreInt32(&p.limiter.limit, 1)
+
+	// the tasks wait for the only worker
+	first := make(chan struct{})
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		i := i
+		p.Go(func() {
+			if i == 0 {
+				<-first
+			} else {
+				<-block
+			}
+			wg.Done()
+		})
+	}
+	if c := p.WorkerCount(); c != 1 {
+		t.Error(c)
+	}
+	// the next task waits too long, which raises the limit and starts a worker for the queued tasks
+	clock.Advance(2 * time.Second)
+	close(first)
+	deadline := time.Now().Add(time.Second)
+	for p.WorkerCount() != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if c := p.WorkerCount(); c != 2 {
+		t.Error(c)
+	}
+	if m := p.Metrics(); m.EffectiveCap != 2 {
+		t.Error(m.EffectiveCap)
+	}
+	close(block)
+	wg.Wait()
+}
@@ -14,8 +14,14 @@
 
 package gopool
 
+import (
+	"context"
+	"time"
+)
+
 const (
-	defaultScalaThreshold = 1
+	defaultScalaThreshold      = 1
+	defaultStarvationThreshold = 8
 )
 
 // Config is used to config pool.
@@ -24,12 +30,71 @@ type Config struct {
 	// new goroutine is created if len(task chan) > ScaleThreshold.
 	// defaults to defaultScalaThreshold.
 	ScaleThreshold int32
+
+	// a waiting task of lower priority is run after StarvationThreshold tasks
+	// of higher priorities are run in a row, so that it's not starved.
+	// defaults to defaultStarvationThreshold.
+	StarvationThreshold int32
+
+	// the max number of queued tasks, RejectPolicy is applied when the queue is full.
+	// 0 means unbounded.
+	MaxQueueSize int32
+	// RejectPolicy handles the tasks submitted when the queue is full,
+	// defaults to RejectBlock.
+	RejectPolicy RejectPolicy
+
+	// an idle worker waits for new tasks for IdleTimeout before exiting,
+	// so that the goroutines and their grown stacks are reused by bursty tasks.
+	// 0 means exiting immediately.
+	IdleTimeout time.Duration
+	// the number of workers kept waiting for new tasks even if they're idle,
+	// they're started with the pool.
+	MinWorkers int32
+
+	// if SkipCancelledTasks is true, the tasks whose context is already done when they're dequeued are
+	// skipped instead of being run, e.g. the callers have given up waiting during an overload.
+	SkipCancelledTasks bool
+	// SkipHandler is called with the context and its error of each skipped task, if set.
+	// It's called on the worker goroutine, so it should not block.
+	SkipHandler func(ctx context.Context, err error)
+
+	// if RecordTaskTime is true, the wait time and execution time of tasks are recorded
+	// in the histograms of Metrics, at the cost of reading the clock 4 times per task.
+	RecordTaskTime bool
+
+	// if AdaptiveScaling is set, the number of workers is limited by an effective cap adjusted
+	// from the observed wait time and throughput of tasks, which doesn't exceed the cap of the pool.
+	AdaptiveScaling *AdaptiveScaling
+
+	// if Tenants is not nil, the tasks are queued per tenant carried by their context, see WithTenant,
+	// and the tenants share the workers by weighted fair queueing, so that a burst of a tenant doesn't
+	// starve the others. Tenants holds the quotas of tenants, DefaultTenant is used for the ones not in it.
+	// The tenants should be a bounded set, since their states are kept for metrics.
+	Tenants       map[string]TenantConfig
+	DefaultTenant TenantConfig
 }
 
+// RejectPolicy handles the tasks submitted to a pool whose queue is full.
+// TryGo returns ErrPoolFull instead of applying it.
+type RejectPolicy int
+
+const (
+	// RejectBlock blocks the submitter until there's space in the queue, or the context is done,
+	// in which case the task is discarded.
+	RejectBlock RejectPolicy = iota
+	// RejectAbort discards the task.
+	RejectAbort
+	// RejectCallerRuns runs the task on the goroutine of the submitter.
+	RejectCallerRuns
+	// RejectDropOldest discards the oldest queued task of the lowest priority to make space.
+	RejectDropOldest
+)
+
 // NewConfig creates a default Config.
 func NewConfig() *Config {
 	c := &Config{
-		ScaleThreshold: defaultScalaThreshold,
+		ScaleThreshold:      defaultScalaThreshold,
+		StarvationThreshold: defaultStarvationThreshold,
 	}
 	return c
 }
@@ -0,0 +1,153 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// PanicError is the error of a task which panicked.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("gopool: panic in task: %v", e.Value)
+}
+
+// dropReporter is implemented by the pools reporting the tasks discarded without running.
+type dropReporter interface {
+	ctxGoOrDrop(ctx context.Context, f func(), drop func(err error))
+	// ctxTryGoOrDrop is like ctxGoOrDrop, but discards f with ErrPoolFull instead of applying
+	// the RejectPolicy if the queue is full.
+	ctxTryGoOrDrop(ctx context.Context, f func(), drop func(err error))
+}
+
+// ctxGoCatch runs f in p and calls done with its result, which is the error returned by f,
+// a *PanicError if f panics, or the error why f is discarded without running.
+// The panic is still handled by the pool after done is called.
+func ctxGoCatch(p Pool, ctx context.Context, f func() error, done func(err error)) {
+	run := func() {
+		panicked := true
+		defer func() {
+			if panicked {
+				r := recover()
+				done(&PanicError{Value: r, Stack: debug.Stack()})
+				panic(r)
+			}
+		}()
+		err := f()
+		panicked = false
+		done(err)
+	}
+	if dp, ok := p.(dropReporter); ok {
+		dp.ctxGoOrDrop(ctx, run, done)
+	} else {
+		p.CtxGo(ctx, run)
+	}
+}
+
+// Future is the result of a task submitted by Submit.
+type Future[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+// Submit runs f in p, and returns the Future of its result.
+// If f panics, Get returns a *PanicError, and the panic is also handled by the panic handler of p.
+func Submit[T any](p Pool, ctx context.Context, f func(ctx context.Context) (T, error)) *Future[T] {
+	fut := &Future[T]{done: make(chan struct{})}
+	ctxGoCatch(p, ctx, func() (err error) {
+		fut.val, err = f(ctx)
+		return err
+	}, func(err error) {
+		fut.err = err
+		close(fut.done)
+	})
+	return fut
+}
+
+// Done returns a channel closed when the task is done.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Get waits for the result of the task until ctx is done, in which case ctx.Err() is returned.
+func (f *Future[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Group is a group of tasks running in a pool, like errgroup.Group.
+// A zero Group is not valid, use NewGroup or GroupWithContext.
+type Group struct {
+	pool   Pool
+	ctx    context.Context
+	cancel func()
+
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+}
+
+// NewGroup returns a Group running tasks in p.
+func NewGroup(p Pool) *Group {
+	return &Group{pool: p, ctx: context.Background()}
+}
+
+// GroupWithContext returns a Group running tasks in p, and a context derived from ctx,
+// which is canceled when a task returns an error or panics, or Wait returns.
+func GroupWithContext(ctx context.Context, p Pool) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{pool: p, ctx: ctx, cancel: cancel}, ctx
+}
+
+// Go runs f in the pool of the group.
+// The first error returned by the tasks, including a *PanicError if a task panics, is returned by Wait.
+func (g *Group) Go(f func() error) {
+	g.wg.Add(1)
+	ctxGoCatch(g.pool, g.ctx, f, func(err error) {
+		if err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				if g.cancel != nil {
+					g.cancel()
+				}
+			})
+		}
+		g.wg.Done()
+	})
+}
+
+// Wait waits for all the tasks, and returns the first error of them.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil {
+		g.cancel()
+	}
+	return g.err
+}
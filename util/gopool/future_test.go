@@ -0,0 +1,126 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubmit(t *testing.T) {
+	p := NewPool("test", 10, NewConfig()).(*pool)
+	p.SetPanicHandler(func(context.Context, interface{}) {})
+	ctx := context.Background()
+
+	v, err := Submit(p, ctx, func(ctx context.Context) (int, error) {
+		return 1, nil
+	}).Get(ctx)
+	if v != 1 || err != nil {
+		t.Error(v, err)
+	}
+
+	errTest := errors.New("test")
+	_, err = Submit(p, ctx, func(ctx context.Context) (int, error) {
+		return 0, errTest
+	}).Get(ctx)
+	if err != errTest {
+		t.Error(err)
+	}
+
+	_, err = Submit(p, ctx, func(ctx context.Context) (int, error) {
+		panic("test")
+	}).Get(ctx)
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Value != "test" || len(pe.Stack) == 0 {
+		t.Error(err)
+	}
+	// the panic is still handled by the pool
+	time.Sleep(10 * time.Millisecond)
+	if n := p.Metrics().Panicked; n != 1 {
+		t.Error(n)
+	}
+
+	fut := Submit(p, ctx, func(ctx context.Context) (int, error) {
+		time.Sleep(50 * time.Millisecond)
+		return 2, nil
+	})
+	tctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if _, err = fut.Get(tctx); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+	<-fut.Done()
+	if v, err = fut.Get(ctx); v != 2 || err != nil {
+		t.Error(v, err)
+	}
+}
+
+func TestSubmitRejected(t *testing.T) {
+	config := NewConfig()
+	config.MaxQueueSize = 1
+	config.RejectPolicy = RejectAbort
+	p, release := newBlockedPool(config)
+	defer release()
+
+	ctx := context.Background()
+	Submit(p, ctx, func(ctx context.Context) (int, error) { return 1, nil })
+	_, err := Submit(p, ctx, func(ctx context.Context) (int, error) {
+		return 2, nil
+	}).Get(ctx)
+	if err != ErrPoolFull {
+		t.Error(err)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	p := NewPool("test", 10, NewConfig())
+	g := NewGroup(p)
+	var n int32
+	for i := 0; i < 100; i++ {
+		g.Go(func() error {
+			atomic.AddInt32(&n, 1)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil || n != 100 {
+		t.Error(err, n)
+	}
+
+	errTest := errors.New("test")
+	g, ctx := GroupWithContext(context.Background(), p)
+	g.Go(func() error {
+		return errTest
+	})
+	g.Go(func() error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := g.Wait(); err != errTest {
+		t.Error(err)
+	}
+
+	p.SetPanicHandler(func(context.Context, interface{}) {})
+	g = NewGroup(p)
+	g.Go(func() error {
+		panic("test")
+	})
+	var pe *PanicError
+	if err := g.Wait(); !errors.As(err, &pe) {
+		t.Error(err)
+	}
+}
@@ -22,12 +22,12 @@ import (
 )
 
 // defaultPool is the global default pool.
-var defaultPool Pool
+var defaultPool *pool
 
 var poolMap sync.Map
 
 func init() {
-	defaultPool = NewPool("gopool.DefaultPool", math.MaxInt32, NewConfig())
+	defaultPool = NewPool("gopool.DefaultPool", math.MaxInt32, NewConfig()).(*pool)
 }
 
 // Go is an alternative to the go keyword, which is able to recover panic.
@@ -43,6 +43,11 @@ func CtxGo(ctx context.Context, f func()) {
 	defaultPool.CtxGo(ctx, f)
 }
 
+// CtxGoWithPriority runs f with the given priority in the global pool.
+func CtxGoWithPriority(ctx context.Context, prio Priority, f func()) {
+	defaultPool.CtxGoWithPriority(ctx, prio, f)
+}
+
 // SetCap is not recommended to be called, this func changes the global pool's capacity which will affect other callers.
 func SetCap(cap int32) {
 	defaultPool.SetCap(cap)
@@ -69,6 +74,30 @@ func RegisterPool(p Pool) error {
 	return nil
 }
 
+// Range calls f for each registered pool.
+func Range(f func(p Pool)) {
+	poolMap.Range(func(_, p interface{}) bool {
+		f(p.(Pool))
+		return true
+	})
+}
+
+// UnregisterPool unregisters the pool of name, it doesn't shut down the pool.
+func UnregisterPool(name string) {
+	poolMap.Delete(name)
+}
+
+// Shutdown shuts down the global pool, and waits for its tasks until ctx is done.
+// The tasks submitted by Go and CtxGo are discarded after shutting down.
+func Shutdown(ctx context.Context) error {
+	return defaultPool.Shutdown(ctx)
+}
+
+// ShutdownNow shuts down the global pool, and returns its queued tasks without running them.
+func ShutdownNow() []func() {
+	return defaultPool.ShutdownNow()
+}
+
 // GetPool gets the registered pool by name.
 // Returns nil if not registered.
 func GetPool(name string) Pool {
@@ -0,0 +1,227 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bytedance/gopkg/util/xxhash3"
+)
+
+const defaultKeyedLanes = 256
+
+// KeyedConfig is used to config KeyedPool.
+type KeyedConfig struct {
+	// the number of lanes the keys are hashed to, the tasks in the same lane are run serially,
+	// so more lanes means less blocking between different keys.
+	// defaults to defaultKeyedLanes.
+	Lanes int32
+	// the max number of queued tasks of each key, ErrPoolFull is returned when the queue is full.
+	// 0 means unbounded.
+	MaxQueueSize int32
+	// DropHandler is called with the context, the key and the error of each task accepted but discarded
+	// without running, because the underlying Pool rejects its lane, e.g. it's full or shut down,
+	// or skips it for its context. The discarded tasks are counted by RejectedCount either way.
+	DropHandler func(ctx context.Context, key string, err error)
+}
+
+// NewKeyedConfig creates a default KeyedConfig.
+func NewKeyedConfig() *KeyedConfig {
+	return &KeyedConfig{
+		Lanes: defaultKeyedLanes,
+	}
+}
+
+// KeyedPool runs the tasks of the same key in the order they're submitted, and one at a time,
+// while the tasks of different keys run in parallel in the underlying Pool.
+// Instead of blocking a worker per key, each lane with queued tasks occupies a single worker
+// running them until the lane is empty.
+type KeyedPool struct {
+	// the 64-bit atomic fields are kept first to be aligned on 32-bit platforms.
+	// Record the number of tasks rejected because the queue of key is full,
+	// or discarded because the underlying Pool rejects them.
+	rejectedCount uint64
+
+	pool   Pool
+	config *KeyedConfig
+	lanes  []keyedLane
+}
+
+type keyedTask struct {
+	ctx context.Context
+	key string
+	f   func()
+}
+
+// keyedLane is the FIFO queue of the keys hashed to it.
+type keyedLane struct {
+	mu    sync.Mutex
+	tasks []keyedTask
+	// the number of queued tasks of each key, only used if MaxQueueSize is set
+	queued map[string]int32
+	// running is set if the lane is scheduled in the underlying Pool
+	running bool
+}
+
+// NewKeyedPool creates a KeyedPool running the tasks in p.
+func NewKeyedPool(p Pool, config *KeyedConfig) *KeyedPool {
+	lanes := config.Lanes
+	if lanes <= 0 {
+		lanes = defaultKeyedLanes
+	}
+	return &KeyedPool{
+		pool:   p,
+		config: config,
+		lanes:  make([]keyedLane, lanes),
+	}
+}
+
+// Go runs f after the tasks of key submitted before, returns ErrPoolFull if the queue of key is full.
+func (kp *KeyedPool) Go(key string, f func()) error {
+	return kp.CtxGo(context.Background(), key, f)
+}
+
+// CtxGo runs f after the tasks of key submitted before, returns ErrPoolFull if the queue of key is full.
+// ctx is passed to the underlying Pool when the lane of key is scheduled with f as its first task.
+func (kp *KeyedPool) CtxGo(ctx context.Context, key string, f func()) error {
+	l := &kp.lanes[xxhash3.HashString(key)%uint64(len(kp.lanes))]
+	l.mu.Lock()
+	if max := kp.config.MaxQueueSize; max > 0 {
+		if l.queued[key] >= max {
+			l.mu.Unlock()
+			atomic.AddUint64(&kp.rejectedCount, 1)
+			return ErrPoolFull
+		}
+		if l.queued == nil {
+			l.queued = make(map[string]int32)
+		}
+		l.queued[key]++
+	}
+	l.tasks = append(l.tasks, keyedTask{ctx: ctx, key: key, f: f})
+	start := !l.running
+	l.running = true
+	l.mu.Unlock()
+	if start {
+		kp.schedule(l, ctx)
+	}
+	return nil
+}
+
+// RejectedCount returns the number of tasks rejected because the queue of key is full,
+// or discarded because the underlying Pool rejects them, e.g. it's shut down.
+func (kp *KeyedPool) RejectedCount() uint64 {
+	return atomic.LoadUint64(&kp.rejectedCount)
+}
+
+// schedule runs the tasks of l in the underlying Pool.
+func (kp *KeyedPool) schedule(l *keyedLane, ctx context.Context) {
+	run := func() { kp.drain(l) }
+	if dp, ok := kp.pool.(dropReporter); ok {
+		dp.ctxGoOrDrop(ctx, run, func(err error) { kp.drop(l, err) })
+	} else {
+		kp.pool.CtxGo(ctx, run)
+	}
+}
+
+// drain runs the tasks of l until it's empty.
+func (kp *KeyedPool) drain(l *keyedLane) {
+	panicked := true
+	defer func() {
+		// the panic is handled by the underlying Pool, and the rest tasks are run by a new worker
+		if panicked {
+			if ctx, ok := l.next(); ok {
+				go kp.schedule(l, ctx)
+			}
+		}
+	}()
+	for {
+		t, ok := l.pop()
+		if !ok {
+			break
+		}
+		t.f()
+	}
+	panicked = false
+}
+
+// drop is called if the lane is discarded by the underlying Pool. Only the first task is discarded
+// if it's skipped for its context, or all the queued tasks are discarded if the Pool is full or shut down.
+// Each discarded task is reported to KeyedConfig.DropHandler.
+func (kp *KeyedPool) drop(l *keyedLane, err error) {
+	if err == ErrPoolFull || err == ErrPoolClosed {
+		for _, t := range l.clear() {
+			kp.reject(t, err)
+		}
+		return
+	}
+	if t, ok := l.pop(); ok {
+		kp.reject(t, err)
+	}
+	if ctx, ok := l.next(); ok {
+		kp.schedule(l, ctx)
+	}
+}
+
+// reject counts t discarded with err, and reports it to KeyedConfig.DropHandler if set.
+func (kp *KeyedPool) reject(t keyedTask, err error) {
+	atomic.AddUint64(&kp.rejectedCount, 1)
+	if kp.config.DropHandler != nil {
+		kp.config.DropHandler(t.ctx, t.key, err)
+	}
+}
+
+// pop removes the first task, or unsets running if l is empty.
+func (l *keyedLane) pop() (keyedTask, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.tasks) == 0 {
+		l.running = false
+		l.tasks = nil
+		return keyedTask{}, false
+	}
+	t := l.tasks[0]
+	l.tasks[0] = keyedTask{}
+	l.tasks = l.tasks[1:]
+	if l.queued != nil {
+		if l.queued[t.key]--; l.queued[t.key] == 0 {
+			delete(l.queued, t.key)
+		}
+	}
+	return t, true
+}
+
+// next returns the context of the first task to schedule l with, or unsets running if l is empty.
+func (l *keyedLane) next() (context.Context, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.tasks) == 0 {
+		l.running = false
+		return nil, false
+	}
+	return l.tasks[0].ctx, true
+}
+
+// clear removes all the tasks and unsets running, returns the removed tasks.
+func (l *keyedLane) clear() []keyedTask {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tasks := l.tasks
+	l.tasks = nil
+	l.queued = nil
+	l.running = false
+	return tasks
+}
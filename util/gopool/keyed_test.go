@@ -0,0 +1,193 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyedPool(t *testing.T) {
+	kp := NewKeyedPool(NewPool("test", 100, NewConfig()), NewKeyedConfig())
+	const keys, tasks = 10, 100
+	var wg sync.WaitGroup
+	var running [keys]int32
+	var seqs [keys][]int
+	for i := 0; i < tasks; i++ {
+		for k := 0; k < keys; k++ {
+			i, k := i, k
+			wg.Add(1)
+			err := kp.Go(strconv.Itoa(k), func() {
+				defer wg.Done()
+				if n := atomic.AddInt32(&running[k], 1); n != 1 {
+					t.Error("overlapped", k, n)
+				}
+				seqs[k] = append(seqs[k], i)
+				atomic.AddInt32(&running[k], -1)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	wg.Wait()
+	for k := range seqs {
+		if len(seqs[k]) != tasks {
+			t.Fatal(k, len(seqs[k]))
+		}
+		for i, v := range seqs[k] {
+			if i != v {
+				t.Error(k, i, v)
+			}
+		}
+	}
+}
+
+func TestKeyedPoolParallel(t *testing.T) {
+	config := NewKeyedConfig()
+	config.Lanes = 1024
+	kp := NewKeyedPool(NewPool("test", 100, NewConfig()), config)
+	block := make(chan struct{})
+	started := make(chan struct{})
+	kp.Go("a", func() {
+		close(started)
+		<-block
+	})
+	<-started
+	// the tasks of other keys are not blocked by "a"
+	done := make(chan struct{})
+	kp.Go("b", func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("blocked by another key")
+	}
+	close(block)
+}
+
+func TestKeyedPoolMaxQueueSize(t *testing.T) {
+	config := NewKeyedConfig()
+	config.MaxQueueSize = 2
+	kp := NewKeyedPool(NewPool("test", 100, NewConfig()), config)
+	block := make(chan struct{})
+	started := make(chan struct{})
+	kp.Go("a", func() {
+		close(started)
+		<-block
+	})
+	<-started
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for i := 0; i < 2; i++ {
+		if err := kp.Go("a", wg.Done); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := kp.Go("a", wg.Done); err != ErrPoolFull {
+		t.Error(err)
+	}
+	if err := kp.Go("b", wg.Done); err != nil {
+		t.Error(err)
+	}
+	if c := kp.RejectedCount(); c != 1 {
+		t.Error(c)
+	}
+	close(block)
+	wg.Wait()
+}
+
+func TestKeyedPoolPanic(t *testing.T) {
+	p := NewPool("test", 100, NewConfig())
+	p.SetPanicHandler(func(context.Context, interface{}) {})
+	kp := NewKeyedPool(p, NewKeyedConfig())
+	done := make(chan struct{})
+	kp.Go("a", testPanicFunc)
+	kp.Go("a", func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("blocked by panic")
+	}
+}
+
+func TestKeyedPoolShutdown(t *testing.T) {
+	p := NewPool("test", 1, NewConfig()).(*pool)
+	config := NewKeyedConfig()
+	var mu sync.Mutex
+	var dropped []string
+	config.DropHandler = func(ctx context.Context, key string, err error) {
+		if err != ErrPoolClosed {
+			t.Error(err)
+		}
+		mu.Lock()
+		dropped = append(dropped, key)
+		mu.Unlock()
+	}
+	kp := NewKeyedPool(p, config)
+	block := make(chan struct{})
+	started := make(chan struct{})
+	p.Go(func() {
+		close(started)
+		<-block
+	})
+	<-started
+	for i := 0; i < 3; i++ {
+		kp.Go("a", func() { t.Error("task is run after shutdown") })
+	}
+	p.ShutdownNow()
+	if c := kp.RejectedCount(); c != 3 {
+		t.Error(c)
+	}
+	close(block)
+
+	// the lane is reset
+	kp.Go("b", func() { t.Error("task is run after shutdown") })
+	if c := kp.RejectedCount(); c != 4 {
+		t.Error(c)
+	}
+	// each discarded task is reported
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"a", "a", "a", "b"}; !reflect.DeepEqual(dropped, want) {
+		t.Error(dropped)
+	}
+}
+
+func BenchmarkKeyedPool(b *testing.B) {
+	kp := NewKeyedPool(NewPool("benchmark", 10000, NewConfig()), NewKeyedConfig())
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	var wg sync.WaitGroup
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Add(benchmarkTimes)
+		for j := 0; j < benchmarkTimes; j++ {
+			kp.Go(keys[j%len(keys)], func() {
+				testFunc()
+				wg.Done()
+			})
+		}
+		wg.Wait()
+	}
+}
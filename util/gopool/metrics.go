@@ -0,0 +1,187 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/gopkg/internal/counter"
+)
+
+// numHistogramBuckets is the number of buckets of a histogram, the upper bound of bucket i is 2^i µs,
+// and the last bucket is unbounded, i.e. durations longer than about 4s.
+const numHistogramBuckets = 24
+
+// Metrics is a snapshot of the metrics of a pool.
+type Metrics struct {
+	Name string
+	// Cap is the capacity of the pool.
+	Cap int32
+	// EffectiveCap is the capacity adjusted by Config.AdaptiveScaling, it equals Cap if not set.
+	EffectiveCap int32
+	// Workers is the number of running workers, including the idle ones.
+	Workers int32
+	// IdleWorkers is the number of workers waiting for new tasks.
+	IdleWorkers int32
+	// QueuedTasks is the number of tasks waiting for workers.
+	QueuedTasks int32
+	// Submitted is the total number of tasks queued.
+	Submitted uint64
+	// Completed is the total number of tasks run without panicking.
+	Completed uint64
+	// Panicked is the total number of tasks panicked.
+	Panicked uint64
+	// Rejected is the total number of tasks rejected because the queue is full.
+	Rejected uint64
+	// Skipped is the total number of tasks skipped because their context is done,
+	// see Config.SkipCancelledTasks.
+	Skipped uint64
+	// WaitTime is the histogram of the time from queuing to running of tasks.
+	// It's only recorded if Config.RecordTaskTime is set.
+	WaitTime Histogram
+	// ExecTime is the histogram of the running time of tasks.
+	// It's only recorded if Config.RecordTaskTime is set.
+	ExecTime Histogram
+	// Tenants are the metrics of each tenant if Config.Tenants is set.
+	Tenants map[string]TenantMetrics
+}
+
+// Histogram is a snapshot of a histogram of durations.
+type Histogram struct {
+	// Bounds are the upper bounds of the buckets, the last bucket has no upper bound.
+	Bounds []time.Duration
+	// Counts are the number of durations in each bucket, Counts[i] counts the durations
+	// less than Bounds[i] and not less than Bounds[i-1].
+	Counts []uint64
+	// Count is the total number of durations.
+	Count uint64
+	// Sum is the sum of durations.
+	Sum time.Duration
+}
+
+// Mean returns the mean of durations.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile returns the upper bound of the bucket where the q-quantile is,
+// or the lower bound of the last bucket if it's there.
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.Count))
+	if rank >= h.Count {
+		rank = h.Count - 1
+	}
+	var n uint64
+	for i, c := range h.Counts {
+		n += c
+		if n > rank && i < len(h.Bounds) {
+			return h.Bounds[i]
+		}
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+var histogramBounds = func() []time.Duration {
+	bounds := make([]time.Duration, numHistogramBuckets-1)
+	for i := range bounds {
+		bounds[i] = time.Microsecond << uint(i)
+	}
+	return bounds
+}()
+
+// histogram is a lock-free histogram of durations.
+type histogram struct {
+	counts [numHistogramBuckets]uint64
+	sum    int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	var us uint64
+	if d > 0 {
+		us = uint64(d / time.Microsecond)
+	}
+	i := bits.Len64(us)
+	if i >= numHistogramBuckets {
+		i = numHistogramBuckets - 1
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	s := Histogram{
+		Bounds: histogramBounds,
+		Counts: make([]uint64, numHistogramBuckets),
+		Sum:    time.Duration(atomic.LoadInt64(&h.sum)),
+	}
+	for i := range h.counts {
+		s.Counts[i] = atomic.LoadUint64(&h.counts[i])
+		s.Count += s.Counts[i]
+	}
+	return s
+}
+
+// poolMetrics records the metrics of a pool.
+type poolMetrics struct {
+	submitted counter.PerP
+	completed counter.PerP
+	panicked  counter.PerP
+	skipped   counter.PerP
+	waitTime  histogram
+	execTime  histogram
+}
+
+func newPoolMetrics() *poolMetrics {
+	return &poolMetrics{
+		submitted: counter.NewPerP(),
+		completed: counter.NewPerP(),
+		panicked:  counter.NewPerP(),
+		skipped:   counter.NewPerP(),
+	}
+}
+
+func (p *pool) Metrics() Metrics {
+	return Metrics{
+		Name:         p.name,
+		Cap:          atomic.LoadInt32(&p.cap),
+		EffectiveCap: p.effectiveCap(),
+		Workers:      p.WorkerCount(),
+		IdleWorkers:  atomic.LoadInt32(&p.idleCount),
+		QueuedTasks:  atomic.LoadInt32(&p.taskCount),
+		Submitted:    uint64(p.metrics.submitted.Get()),
+		Completed:    uint64(p.metrics.completed.Get()),
+		Panicked:     uint64(p.metrics.panicked.Get()),
+		Rejected:     p.RejectedCount(),
+		Skipped:      uint64(p.metrics.skipped.Get()),
+		WaitTime:     p.metrics.waitTime.snapshot(),
+		ExecTime:     p.metrics.execTime.snapshot(),
+		Tenants:      p.tenantMetrics(),
+	}
+}
+
+func (p *pool) tenantMetrics() map[string]TenantMetrics {
+	if p.tenants == nil {
+		return nil
+	}
+	return p.tenants.metrics()
+}
@@ -0,0 +1,132 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	h.observe(0)
+	h.observe(3 * time.Microsecond)
+	h.observe(3 * time.Microsecond)
+	h.observe(time.Hour)
+
+	s := h.snapshot()
+	if s.Count != 4 || s.Counts[0] != 1 || s.Counts[2] != 2 || s.Counts[numHistogramBuckets-1] != 1 {
+		t.Error(s.Counts)
+	}
+	if mean := s.Mean(); mean != (time.Hour+6*time.Microsecond)/4 {
+		t.Error(mean)
+	}
+	if q := s.Quantile(0.5); q != 4*time.Microsecond {
+		t.Error(q)
+	}
+	if q := s.Quantile(0); q != time.Microsecond {
+		t.Error(q)
+	}
+	if q := s.Quantile(1); q != s.Bounds[len(s.Bounds)-1] {
+		t.Error(q)
+	}
+	if q := (Histogram{}).Quantile(0.5); q != 0 {
+		t.Error(q)
+	}
+}
+
+func TestPoolMetrics(t *testing.T) {
+	config := NewConfig()
+	config.RecordTaskTime = true
+	p := NewPool("test", 1, config).(*pool)
+	p.SetPanicHandler(func(context.Context, interface{}) {})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		p.Go(func() {
+			defer wg.Done()
+			time.Sleep(time.Millisecond)
+		})
+	}
+	wg.Add(1)
+	p.Go(func() {
+		defer wg.Done()
+		panic("test")
+	})
+	wg.Wait()
+
+	m := p.Metrics()
+	if m.Name != "test" || m.Submitted != 11 || m.Completed != 10 || m.Panicked != 1 || m.Rejected != 0 {
+		t.Error(m)
+	}
+	if m.WaitTime.Count != 11 || m.ExecTime.Count != 11 {
+		t.Error(m.WaitTime.Count, m.ExecTime.Count)
+	}
+	if m.ExecTime.Sum < 10*time.Millisecond {
+		t.Error(m.ExecTime.Sum)
+	}
+	// the tasks wait for the only worker
+	if m.WaitTime.Quantile(1) < time.Millisecond {
+		t.Error(m.WaitTime.Quantile(1))
+	}
+
+	// not timed by default
+	p = NewPool("test", 1, NewConfig()).(*pool)
+	wg.Add(1)
+	p.Go(wg.Done)
+	wg.Wait()
+	m = p.Metrics()
+	if m.Submitted != 1 || m.WaitTime.Count != 0 || m.ExecTime.Count != 0 {
+		t.Error(m)
+	}
+}
+
+func TestPoolMetricsNoAlloc(t *testing.T) {
+	config := NewConfig()
+	config.RecordTaskTime = true
+	p := NewPool("test", 1, config).(*pool)
+	tk := &task{ctx: context.Background(), f: func() {}}
+	allocs := testing.AllocsPerRun(100, func() {
+		p.metrics.submitted.Add(1)
+		p.started(tk)
+		p.runTask(tk)
+	})
+	if allocs != 0 {
+		t.Error(allocs)
+	}
+}
+
+func TestRange(t *testing.T) {
+	names := []string{"test_range_a", "test_range_b"}
+	for _, name := range names {
+		if err := RegisterPool(NewPool(name, 1, NewConfig())); err != nil {
+			t.Fatal(err)
+		}
+		defer poolMap.Delete(name)
+	}
+	var got []string
+	Range(func(p Pool) {
+		if m := p.(MetricsProvider).Metrics(); m.Name == names[0] || m.Name == names[1] {
+			got = append(got, m.Name)
+		}
+	})
+	sort.Strings(got)
+	if len(got) != 2 || got[0] != names[0] || got[1] != names[1] {
+		t.Error(got)
+	}
+}
@@ -16,10 +16,15 @@ package gopool
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// ErrPoolFull is returned by TryGo if the task queue of the pool is full.
+var ErrPoolFull = errors.New("gopool: task queue is full")
+
 type Pool interface {
 	// Name returns the corresponding pool name.
 	Name() string
@@ -28,6 +33,7 @@ type Pool interface {
 	// Go executes f.
 	Go(f func())
 	// CtxGo executes f and accepts the context.
+	// f is run with the priority and tenant carried by ctx, see WithPriority and WithTenant.
 	CtxGo(ctx context.Context, f func())
 	// SetPanicHandler sets the panic handler.
 	SetPanicHandler(f func(context.Context, interface{}))
@@ -35,6 +41,61 @@ type Pool interface {
 	WorkerCount() int32
 }
 
+// The interfaces below are optional, they are implemented by the pools created by NewPool,
+// and found by type assertion, e.g.
+//
+//	if tp, ok := p.(gopool.TryGoer); ok {
+//		err = tp.TryGo(f)
+//	}
+
+// PriorityGoer runs tasks with priorities.
+type PriorityGoer interface {
+	// CtxGoWithPriority executes f with the given priority and accepts the context.
+	CtxGoWithPriority(ctx context.Context, prio Priority, f func())
+}
+
+// TenantGoer runs tasks for tenants.
+type TenantGoer interface {
+	// CtxGoWithTenant executes f for the given tenant and accepts the context, see Config.Tenants.
+	CtxGoWithTenant(ctx context.Context, tenant string, f func())
+}
+
+// TryGoer runs tasks without blocking on a full task queue.
+type TryGoer interface {
+	// TryGo executes f, returns ErrPoolFull if the task queue is full.
+	TryGo(f func()) error
+	// CtxTryGo executes f and accepts the context, returns ErrPoolFull if the task queue is full.
+	CtxTryGo(ctx context.Context, f func()) error
+	// RejectedCount returns the number of tasks rejected because the task queue is full,
+	// or the pool is shut down.
+	RejectedCount() uint64
+}
+
+// MetricsProvider reports the metrics of a pool.
+type MetricsProvider interface {
+	// Metrics returns a snapshot of the metrics of the pool.
+	Metrics() Metrics
+}
+
+// Shutdowner shuts down a pool.
+type Shutdowner interface {
+	// Shutdown rejects new tasks, and waits for the queued and running tasks until ctx is done,
+	// in which case ctx.Err() is returned.
+	Shutdown(ctx context.Context) error
+	// ShutdownNow rejects new tasks, and returns the queued tasks without running them.
+	ShutdownNow() []func()
+}
+
+var (
+	_ Pool            = (*pool)(nil)
+	_ PriorityGoer    = (*pool)(nil)
+	_ TenantGoer      = (*pool)(nil)
+	_ TryGoer         = (*pool)(nil)
+	_ MetricsProvider = (*pool)(nil)
+	_ Shutdowner      = (*pool)(nil)
+	_ dropReporter    = (*pool)(nil)
+)
+
 var taskPool sync.Pool
 
 func init() {
@@ -42,8 +103,14 @@ func init() {
 }
 
 type task struct {
-	ctx context.Context
-	f   func()
+	ctx      context.Context
+	f        func()
+	prio     int8 // index of the priority
+	queuedAt time.Time
+	// drop is called if the task is discarded without running.
+	drop func(err error)
+	// tenant is set when the task is pushed if Config.Tenants is set
+	tenant *tenant
 
 	next *task
 }
@@ -51,6 +118,10 @@ type task struct {
 func (t *task) zero() {
 	t.ctx = nil
 	t.f = nil
+	t.prio = 0
+	t.queuedAt = time.Time{}
+	t.drop = nil
+	t.tenant = nil
 	t.next = nil
 }
 
@@ -63,13 +134,12 @@ func newTask() interface{} {
 	return &task{}
 }
 
-type taskList struct {
-	sync.Mutex
-	taskHead *task
-	taskTail *task
-}
-
 type pool struct {
+	// the 64-bit atomic fields are kept first to be aligned on 32-bit platforms.
+	// Record the number of tasks rejected because the queue is full
+	rejectedCount uint64
+	metrics       *poolMetrics
+
 	// The name of the pool
 	name string
 
@@ -77,14 +147,33 @@ type pool struct {
 	cap int32
 	// Configuration information
 	config *Config
-	// linked list of tasks
-	taskHead  *task
-	taskTail  *task
+	// queue of tasks per priority, or per tenant if Config.Tenants is set
+	queue     taskQueue
 	taskLock  sync.Mutex
 	taskCount int32
+	// tenants is the queue if Config.Tenants is set
+	tenants *tenantQueue
+	// closed when there's space in the task queue, to wake up the blocked submitters.
+	spaceChan chan struct{}
 
 	// Record the number of running workers
 	workerCount int32
+	// the parked workers waiting for new tasks, guarded by taskLock
+	idleWorkers []*worker
+	// idleCount is the length of idleWorkers for the metrics
+	idleCount int32
+
+	// clock of the metrics and adaptive scaling
+	clock Clock
+	// timing is set if the tasks are timed, for Config.RecordTaskTime or Config.AdaptiveScaling
+	timing bool
+	// limiter adjusts the effective cap if Config.AdaptiveScaling is set
+	limiter *adaptiveLimiter
+
+	// closed is set on shutting down, drained is closed when the tasks are all done then,
+	// both are guarded by taskLock.
+	closed  int32
+	drained chan struct{}
 
 	// This method will be called when the worker panic
 	panicHandler func(context.Context, interface{})
@@ -93,9 +182,31 @@ type pool struct {
 // NewPool creates a new pool with the given name, cap and config.
 func NewPool(name string, cap int32, config *Config) Pool {
 	p := &pool{
-		name:   name,
-		cap:    cap,
-		config: config,
+		name:    name,
+		cap:     cap,
+		config:  config,
+		metrics: newPoolMetrics(),
+		clock:   systemClock{},
+		drained: make(chan struct{}),
+	}
+	if config.AdaptiveScaling != nil {
+		p.limiter = newAdaptiveLimiter(*config.AdaptiveScaling, cap)
+		p.clock = p.limiter.opt.Clock
+	}
+	p.timing = config.RecordTaskTime || p.limiter != nil
+	starvationThreshold := config.StarvationThreshold
+	if starvationThreshold <= 0 {
+		starvationThreshold = defaultStarvationThreshold
+	}
+	if config.Tenants != nil {
+		p.tenants = newTenantQueue(config, starvationThreshold)
+		p.queue = p.tenants
+	} else {
+		p.queue = newPriorityQueue(starvationThreshold)
+	}
+	// start the warm workers
+	for i := int32(0); i < config.MinWorkers && i < cap; i++ {
+		p.spawn()
 	}
 	return p
 }
@@ -113,29 +224,221 @@ func (p *pool) Go(f func()) {
 }
 
 func (p *pool) CtxGo(ctx context.Context, f func()) {
+	p.CtxGoWithPriority(ctx, PriorityFromContext(ctx), f)
+}
+
+func (p *pool) CtxGoWithPriority(ctx context.Context, prio Priority, f func()) {
+	p.submit(ctx, prio, f, nil, false)
+}
+
+func (p *pool) CtxGoWithTenant(ctx context.Context, tenant string, f func()) {
+	p.CtxGo(WithTenant(ctx, tenant), f)
+}
+
+func (p *pool) TryGo(f func()) error {
+	return p.CtxTryGo(context.Background(), f)
+}
+
+func (p *pool) CtxTryGo(ctx context.Context, f func()) error {
+	return p.submit(ctx, PriorityFromContext(ctx), f, nil, true)
+}
+
+func (p *pool) ctxGoOrDrop(ctx context.Context, f func(), drop func(err error)) {
+	p.submit(ctx, PriorityFromContext(ctx), f, drop, false)
+}
+
+func (p *pool) ctxTryGoOrDrop(ctx context.Context, f func(), drop func(err error)) {
+	p.submit(ctx, PriorityFromContext(ctx), f, drop, true)
+}
+
+// submit enqueues f, if the queue is full, it applies RejectPolicy,
+// or returns ErrPoolFull if try is true.
+// drop is called if f is discarded without running.
+func (p *pool) submit(ctx context.Context, prio Priority, f func(), drop func(err error), try bool) error {
 	t := taskPool.Get().(*task)
 	t.ctx = ctx
 	t.f = f
+	t.prio = prio.index()
+	t.drop = drop
 	p.taskLock.Lock()
-	if p.taskHead == nil {
-		p.taskHead = t
-		p.taskTail = t
-	} else {
-		p.taskTail.next = t
-		p.taskTail = t
+	for {
+		if atomic.LoadInt32(&p.closed) != 0 {
+			p.taskLock.Unlock()
+			p.reject(t, ErrPoolClosed)
+			return ErrPoolClosed
+		}
+		if p.config.MaxQueueSize <= 0 || atomic.LoadInt32(&p.taskCount) < p.config.MaxQueueSize {
+			break
+		}
+		policy := p.config.RejectPolicy
+		if try {
+			policy = RejectAbort
+		}
+		switch policy {
+		case RejectBlock:
+			if p.spaceChan == nil {
+				p.spaceChan = make(chan struct{})
+			}
+			ch := p.spaceChan
+			p.taskLock.Unlock()
+			select {
+			case <-ch:
+				p.taskLock.Lock()
+				continue
+			case <-ctx.Done():
+				p.reject(t, ctx.Err())
+				return ctx.Err()
+			}
+		case RejectCallerRuns:
+			p.taskLock.Unlock()
+			atomic.AddUint64(&p.rejectedCount, 1)
+			p.runTask(t)
+			t.Recycle()
+			return nil
+		case RejectDropOldest:
+			old := p.queue.popOldest()
+			atomic.AddInt32(&p.taskCount, -1)
+			p.taskLock.Unlock()
+			p.reject(old, ErrPoolFull)
+			p.taskLock.Lock()
+			continue
+		default:
+			p.taskLock.Unlock()
+			p.reject(t, ErrPoolFull)
+			return ErrPoolFull
+		}
 	}
-	p.taskLock.Unlock()
+	if p.timing {
+		t.queuedAt = p.clock.Now()
+	}
+	p.queue.push(t)
 	atomic.AddInt32(&p.taskCount, 1)
+	p.metrics.submitted.Add(1)
+	woken := p.wakeIdle()
+	p.taskLock.Unlock()
+	if woken {
+		return nil
+	}
 	// The following two conditions are met:
 	// 1. the number of tasks is greater than the threshold.
-	// 2. The current number of workers is less than the upper limit p.cap.
+	// 2. The current number of workers is less than the upper limit p.cap, or the adaptive limit.
 	// or there are currently no workers.
-	if (atomic.LoadInt32(&p.taskCount) >= p.config.ScaleThreshold && p.WorkerCount() < atomic.LoadInt32(&p.cap)) || p.WorkerCount() == 0 {
-		p.incWorkerCount()
-		w := workerPool.Get().(*worker)
-		w.pool = p
-		w.run()
+	if (atomic.LoadInt32(&p.taskCount) >= p.config.ScaleThreshold && p.WorkerCount() < p.effectiveCap()) || p.WorkerCount() == 0 {
+		p.spawn()
+	}
+	return nil
+}
+
+// effectiveCap returns the cap adjusted by the adaptive scaling.
+func (p *pool) effectiveCap() int32 {
+	cap := atomic.LoadInt32(&p.cap)
+	if p.limiter != nil {
+		if limit := p.limiter.Limit(); limit < cap {
+			return limit
+		}
+	}
+	return cap
+}
+
+// scaleUp starts the workers for the queued tasks up to the effective cap, after it's raised,
+// since the workers are otherwise only started by submitting.
+func (p *pool) scaleUp() {
+	n := p.effectiveCap() - p.WorkerCount()
+	if queued := atomic.LoadInt32(&p.taskCount); queued < n {
+		n = queued
+	}
+	for i := int32(0); i < n; i++ {
+		p.spawn()
+	}
+}
+
+func (p *pool) spawn() {
+	p.incWorkerCount()
+	w := workerPool.Get().(*worker)
+	w.pool = p
+	w.run()
+}
+
+// keepIdle reports whether an idle worker should park instead of exiting.
+func (p *pool) keepIdle() bool {
+	if atomic.LoadInt32(&p.closed) != 0 {
+		return false
+	}
+	return p.config.IdleTimeout > 0 || p.WorkerCount() <= p.config.MinWorkers
+}
+
+// wakeIdle wakes up a parked worker if any, it must be called with taskLock held.
+func (p *pool) wakeIdle() bool {
+	n := len(p.idleWorkers)
+	if n == 0 {
+		return false
+	}
+	w := p.idleWorkers[n-1]
+	p.idleWorkers[n-1] = nil
+	p.idleWorkers = p.idleWorkers[:n-1]
+	atomic.AddInt32(&p.idleCount, -1)
+	w.wake <- struct{}{}
+	return true
+}
+
+// removeIdle removes w from the parked workers, it must be called with taskLock held.
+func (p *pool) removeIdle(w *worker) bool {
+	for i, idle := range p.idleWorkers {
+		if idle == w {
+			last := len(p.idleWorkers) - 1
+			copy(p.idleWorkers[i:], p.idleWorkers[i+1:])
+			p.idleWorkers[last] = nil
+			p.idleWorkers = p.idleWorkers[:last]
+			atomic.AddInt32(&p.idleCount, -1)
+			return true
+		}
+	}
+	return false
+}
+
+// reject discards t because the queue is full or the pool is shut down.
+func (p *pool) reject(t *task, err error) {
+	atomic.AddUint64(&p.rejectedCount, 1)
+	if t.drop != nil {
+		t.drop(err)
+	}
+	t.Recycle()
+}
+
+// hasTask reports whether there's a task to pop, the tasks throttled by Config.Tenants are not counted.
+func (p *pool) hasTask() bool {
+	if p.tenants != nil {
+		return p.tenants.ready()
+	}
+	return atomic.LoadInt32(&p.taskCount) > 0
+}
+
+// doneTask is called when a popped task is done, ran is false if it's skipped or discarded.
+func (p *pool) doneTask(t *task, ran bool) {
+	if t.tenant != nil {
+		p.tenants.done(t.tenant, ran)
+	}
+}
+
+// popTask pops a task from the queue, and wakes up the blocked submitters if any.
+func (p *pool) popTask() *task {
+	p.taskLock.Lock()
+	t := p.popped(p.queue.pop())
+	p.taskLock.Unlock()
+	return t
+}
+
+// popped is called with the task popped from the queue if not nil, it returns t.
+// It must be called with taskLock held.
+func (p *pool) popped(t *task) *task {
+	if t != nil {
+		atomic.AddInt32(&p.taskCount, -1)
+		if p.spaceChan != nil {
+			close(p.spaceChan)
+			p.spaceChan = nil
+		}
 	}
+	return t
 }
 
 // SetPanicHandler the func here will be called after the panic has been recovered.
@@ -147,6 +450,10 @@ func (p *pool) WorkerCount() int32 {
 	return atomic.LoadInt32(&p.workerCount)
 }
 
+func (p *pool) RejectedCount() uint64 {
+	return atomic.LoadUint64(&p.rejectedCount)
+}
+
 func (p *pool) incWorkerCount() {
 	atomic.AddInt32(&p.workerCount, 1)
 }
@@ -15,10 +15,13 @@
 package gopool
 
 import (
+	"context"
+	"reflect"
 	"runtime"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 const benchmarkTimes = 10000
@@ -60,6 +63,232 @@ func TestPoolPanic(t *testing.T) {
 	p.Go(testPanicFunc)
 }
 
+// newBlockedPool creates a pool with a single worker, which is blocked until the returned func is called.
+func newBlockedPool(config *Config) (*pool, func()) {
+	p := NewPool("test", 1, config).(*pool)
+	started, block := make(chan struct{}), make(chan struct{})
+	p.Go(func() {
+		close(started)
+		<-block
+	})
+	<-started
+	return p, func() { close(block) }
+}
+
+func TestPoolRejectAbort(t *testing.T) {
+	config := NewConfig()
+	config.MaxQueueSize = 2
+	config.RejectPolicy = RejectAbort
+	p, release := newBlockedPool(config)
+
+	var n int32
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		if err := p.TryGo(func() {
+			atomic.AddInt32(&n, 1)
+			wg.Done()
+		}); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := p.TryGo(func() {}); err != ErrPoolFull {
+		t.Error(err)
+	}
+	p.Go(func() { t.Error("rejected task is run") })
+	if c := p.RejectedCount(); c != 2 {
+		t.Error(c)
+	}
+	release()
+	wg.Wait()
+	if n != 2 {
+		t.Error(n)
+	}
+}
+
+func TestPoolRejectCallerRuns(t *testing.T) {
+	config := NewConfig()
+	config.MaxQueueSize = 1
+	config.RejectPolicy = RejectCallerRuns
+	p, release := newBlockedPool(config)
+	defer release()
+
+	p.Go(func() {})
+	ran := false
+	p.Go(func() { ran = true })
+	if !ran {
+		t.Error("task is not run by the caller")
+	}
+	// TryGo doesn't apply the policy
+	if err := p.TryGo(func() {}); err != ErrPoolFull {
+		t.Error(err)
+	}
+	p.Go(testPanicFunc)
+	if c := p.RejectedCount(); c != 3 {
+		t.Error(c)
+	}
+}
+
+func TestPoolRejectDropOldest(t *testing.T) {
+	config := NewConfig()
+	config.MaxQueueSize = 2
+	config.RejectPolicy = RejectDropOldest
+	p, release := newBlockedPool(config)
+
+	var mu sync.Mutex
+	var got []string
+	var wg sync.WaitGroup
+	submit := func(prio Priority, name string) {
+		wg.Add(1)
+		p.CtxGoWithPriority(context.Background(), prio, func() {
+			mu.Lock()
+			got = append(got, name)
+			mu.Unlock()
+			wg.Done()
+		})
+	}
+	submit(PriorityNormal, "a")
+	submit(PriorityLow, "b")
+	wg.Add(-1) // b is dropped
+	submit(PriorityNormal, "c")
+	release()
+	wg.Wait()
+	if !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Error(got)
+	}
+	if c := p.RejectedCount(); c != 1 {
+		t.Error(c)
+	}
+}
+
+func TestPoolRejectBlock(t *testing.T) {
+	config := NewConfig()
+	config.MaxQueueSize = 1
+	p, release := newBlockedPool(config)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	p.Go(wg.Done)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	p.CtxGo(ctx, func() { t.Error("rejected task is run") })
+	if c := p.RejectedCount(); c != 1 {
+		t.Error(c)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.Go(wg.Done)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Error("not blocked")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	<-done
+	wg.Wait()
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	config := NewConfig()
+	config.IdleTimeout = 50 * time.Millisecond
+	p := NewPool("test", 100, config)
+
+	// the parked worker is reused
+	for i := 0; i < 10; i++ {
+		done := make(chan struct{})
+		p.Go(func() { close(done) })
+		<-done
+		time.Sleep(time.Millisecond)
+		if c := p.WorkerCount(); c != 1 {
+			t.Error(c)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if c := p.WorkerCount(); c != 0 {
+		t.Error(c)
+	}
+}
+
+func TestPoolMinWorkers(t *testing.T) {
+	config := NewConfig()
+	config.IdleTimeout = 10 * time.Millisecond
+	config.MinWorkers = 2
+	p := NewPool("test", 100, config)
+	if c := p.WorkerCount(); c != 2 {
+		t.Error(c)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		p.Go(func() {
+			time.Sleep(time.Millisecond)
+			wg.Done()
+		})
+	}
+	wg.Wait()
+	time.Sleep(50 * time.Millisecond)
+	if c := p.WorkerCount(); c != 2 {
+		t.Error(c)
+	}
+
+	// without IdleTimeout
+	config = NewConfig()
+	config.MinWorkers = 2
+	p = NewPool("test", 1, config)
+	if c := p.WorkerCount(); c != 1 {
+		t.Error(c)
+	}
+	done := make(chan struct{})
+	p.Go(func() { close(done) })
+	<-done
+	if c := p.WorkerCount(); c != 1 {
+		t.Error(c)
+	}
+}
+
+func TestPoolSkipCancelledTasks(t *testing.T) {
+	var skipped int32
+	config := NewConfig()
+	config.SkipCancelledTasks = true
+	config.SkipHandler = func(ctx context.Context, err error) {
+		if err != context.Canceled {
+			t.Error(err)
+		}
+		atomic.AddInt32(&skipped, 1)
+	}
+	p, release := newBlockedPool(config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.CtxGo(ctx, func() { t.Error("cancelled task is run") })
+	fut := Submit(p, ctx, func(ctx context.Context) (int, error) { return 1, nil })
+	done := make(chan struct{})
+	p.Go(func() { close(done) })
+	cancel()
+	release()
+	<-done
+
+	if _, err := fut.Get(context.Background()); err != context.Canceled {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&skipped); n != 2 {
+		t.Error(n)
+	}
+	if n := p.Metrics().Skipped; n != 2 {
+		t.Error(n)
+	}
+
+	// not skipped by default
+	p, release = newBlockedPool(NewConfig())
+	done = make(chan struct{})
+	p.CtxGo(ctx, func() { close(done) })
+	release()
+	<-done
+}
+
 func BenchmarkPool(b *testing.B) {
 	config := NewConfig()
 	config.ScaleThreshold = 1
@@ -79,6 +308,25 @@ func BenchmarkPool(b *testing.B) {
 	}
 }
 
+func BenchmarkPoolIdleTimeout(b *testing.B) {
+	config := NewConfig()
+	config.IdleTimeout = time.Second
+	p := NewPool("benchmark", int32(runtime.GOMAXPROCS(0)), config)
+	var wg sync.WaitGroup
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Add(benchmarkTimes)
+		for j := 0; j < benchmarkTimes; j++ {
+			p.Go(func() {
+				testFunc()
+				wg.Done()
+			})
+		}
+		wg.Wait()
+	}
+}
+
 func BenchmarkGo(b *testing.B) {
 	var wg sync.WaitGroup
 	b.ReportAllocs()
@@ -0,0 +1,55 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"context"
+)
+
+// Priority is the priority of a task, the tasks of higher priorities are run first.
+type Priority int8
+
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+
+	numPriorities = int(PriorityHigh-PriorityLow) + 1
+)
+
+// index returns the index of the task list of p, p is clamped to the valid range.
+func (p Priority) index() int8 {
+	if p < PriorityLow {
+		p = PriorityLow
+	} else if p > PriorityHigh {
+		p = PriorityHigh
+	}
+	return int8(p - PriorityLow)
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of ctx carrying prio, which is used by CtxGo.
+func WithPriority(ctx context.Context, prio Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, prio)
+}
+
+// PriorityFromContext returns the priority carried by ctx, defaults to PriorityNormal.
+func PriorityFromContext(ctx context.Context) Priority {
+	if prio, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return prio
+	}
+	return PriorityNormal
+}
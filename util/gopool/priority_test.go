@@ -0,0 +1,76 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestPriorityFromContext(t *testing.T) {
+	ctx := context.Background()
+	if prio := PriorityFromContext(ctx); prio != PriorityNormal {
+		t.Error(prio)
+	}
+	if prio := PriorityFromContext(WithPriority(ctx, PriorityHigh)); prio != PriorityHigh {
+		t.Error(prio)
+	}
+	if idx := Priority(100).index(); idx != PriorityHigh.index() {
+		t.Error(idx)
+	}
+	if idx := Priority(-100).index(); idx != PriorityLow.index() {
+		t.Error(idx)
+	}
+}
+
+func TestPoolPriority(t *testing.T) {
+	p := NewPool("test", 1, NewConfig()).(*pool)
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	p.Go(func() {
+		<-block
+		wg.Done()
+	})
+
+	var mu sync.Mutex
+	var got []Priority
+	submit := func(ctx context.Context, prio Priority) {
+		wg.Add(1)
+		f := func() {
+			mu.Lock()
+			got = append(got, prio)
+			mu.Unlock()
+			wg.Done()
+		}
+		if ctx != nil {
+			p.CtxGo(ctx, f)
+		} else {
+			p.CtxGoWithPriority(context.Background(), prio, f)
+		}
+	}
+	submit(nil, PriorityLow)
+	submit(context.Background(), PriorityNormal)
+	submit(WithPriority(context.Background(), PriorityHigh), PriorityHigh)
+	close(block)
+	wg.Wait()
+
+	expected := []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+	if !reflect.DeepEqual(got, expected) {
+		t.Error(got)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+// taskQueue is the task queue of a pool, it's guarded by pool.taskLock.
+// The higher priorities are popped first, but a task of lower priority is popped
+// once it has been passed over starvationThreshold times.
+type taskQueue interface {
+	push(t *task)
+	pop() *task
+	// popOldest pops the oldest task of the lowest priority.
+	popOldest() *task
+}
+
+type taskList struct {
+	taskHead *task
+	taskTail *task
+}
+
+func (l *taskList) push(t *task) {
+	if l.taskHead == nil {
+		l.taskHead = t
+		l.taskTail = t
+	} else {
+		l.taskTail.next = t
+		l.taskTail = t
+	}
+}
+
+func (l *taskList) pop() *task {
+	t := l.taskHead
+	if t != nil {
+		l.taskHead = t.next
+		t.next = nil
+	}
+	return t
+}
+
+// priorityLists holds a FIFO list of tasks per priority, it's not safe for concurrent use.
+type priorityLists struct {
+	lists [numPriorities]taskList
+	// skipped is the number of consecutive pops passing over the non-empty list of each priority.
+	skipped [numPriorities]int32
+}
+
+func (l *priorityLists) push(t *task) {
+	l.lists[t.prio].push(t)
+}
+
+func (l *priorityLists) popOldest() *task {
+	for i := range l.lists {
+		if t := l.lists[i].pop(); t != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+func (l *priorityLists) pop(starvationThreshold int32) *task {
+	pick := -1
+	for i := numPriorities - 1; i >= 0; i-- {
+		if l.lists[i].taskHead != nil {
+			pick = i
+			break
+		}
+	}
+	if pick < 0 {
+		return nil
+	}
+	for i := 0; i < pick; i++ {
+		if l.lists[i].taskHead != nil && l.skipped[i] >= starvationThreshold {
+			pick = i
+			break
+		}
+	}
+	for i := 0; i < pick; i++ {
+		if l.lists[i].taskHead != nil {
+			l.skipped[i]++
+		}
+	}
+	l.skipped[pick] = 0
+	return l.lists[pick].pop()
+}
+
+// priorityQueue is the taskQueue of a pool without tenants.
+type priorityQueue struct {
+	tasks               priorityLists
+	starvationThreshold int32
+}
+
+func newPriorityQueue(starvationThreshold int32) taskQueue {
+	return &priorityQueue{starvationThreshold: starvationThreshold}
+}
+
+func (q *priorityQueue) push(t *task) {
+	q.tasks.push(t)
+}
+
+func (q *priorityQueue) popOldest() *task {
+	return q.tasks.popOldest()
+}
+
+func (q *priorityQueue) pop() *task {
+	return q.tasks.pop(q.starvationThreshold)
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTaskQueue(t *testing.T) {
+	q := newPriorityQueue(2)
+	push := func(prio Priority, n int) {
+		for i := 0; i < n; i++ {
+			q.push(&task{prio: prio.index()})
+		}
+	}
+	push(PriorityLow, 1)
+	push(PriorityNormal, 2)
+	push(PriorityHigh, 4)
+
+	var got []Priority
+	for tk := q.pop(); tk != nil; tk = q.pop() {
+		got = append(got, Priority(tk.prio)+PriorityLow)
+	}
+	// the low and normal tasks are run after being passed over twice.
+	expected := []Priority{
+		PriorityHigh, PriorityHigh, PriorityLow,
+		PriorityNormal, PriorityHigh, PriorityHigh, PriorityNormal,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Error(got)
+	}
+
+	push(PriorityHigh, 1)
+	push(PriorityLow, 1)
+	if tk := q.popOldest(); tk == nil || tk.prio != PriorityLow.index() {
+		t.Error(tk)
+	}
+}
+
+func BenchmarkTaskQueue(b *testing.B) {
+	q := newPriorityQueue(defaultStarvationThreshold)
+	b.ReportAllocs()
+	b.ResetTimer()
+	t := &task{}
+	for i := 0; i < b.N; i++ {
+		q.push(t)
+		t = q.pop()
+	}
+}
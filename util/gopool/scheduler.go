@@ -0,0 +1,351 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSchedulerTick = 10 * time.Millisecond
+
+	// the timing wheel has wheelLevels levels of wheelSlots slots, the slots of level l span wheelSlots^l ticks.
+	wheelBits   = 6
+	wheelSlots  = 1 << wheelBits
+	wheelMask   = wheelSlots - 1
+	wheelLevels = 6
+	// the max ticks the wheel spans, the timers due later are cascaded again at the end of it.
+	wheelSpan = 1 << (wheelBits * wheelLevels)
+)
+
+// SchedulerConfig is used to config Scheduler.
+type SchedulerConfig struct {
+	// the resolution of timers, a timer is run on the first tick not earlier than its due time.
+	// defaults to defaultSchedulerTick.
+	Tick time.Duration
+	// Clock defaults to the system clock.
+	Clock Clock
+}
+
+// NewSchedulerConfig creates a default SchedulerConfig.
+func NewSchedulerConfig() *SchedulerConfig {
+	return &SchedulerConfig{
+		Tick:  defaultSchedulerTick,
+		Clock: systemClock{},
+	}
+}
+
+// Scheduler runs delayed and periodic tasks in a Pool, so that they respect the cap and
+// the panic handler of the pool. The timers are managed by a hierarchical timing wheel,
+// which costs O(1) to add or cancel a timer.
+type Scheduler struct {
+	// the 64-bit atomic fields are kept first to be aligned on 32-bit platforms.
+	// Record the number of runs discarded by the pool.
+	missedCount uint64
+
+	pool   Pool
+	tick   time.Duration
+	clock  Clock
+	origin time.Time
+
+	mu    sync.Mutex
+	now   uint64 // ticks elapsed since origin
+	wheel [wheelLevels][wheelSlots]timerList
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Timer is the handle of a task scheduled by Scheduler.
+type Timer struct {
+	s        *Scheduler
+	f        func()
+	due      uint64 // the tick when the timer is due
+	interval uint64 // ticks between the runs of a periodic timer, 0 if it runs once
+	running  int32  // set while f of a periodic timer is running
+
+	// the slot the timer is in, nil if it's run or cancelled, guarded by s.mu
+	list       *timerList
+	prev, next *Timer
+}
+
+// timerList is the doubly linked list of the timers in a slot.
+type timerList struct {
+	head *Timer
+}
+
+func (l *timerList) push(t *Timer) {
+	t.list = l
+	t.prev = nil
+	t.next = l.head
+	if l.head != nil {
+		l.head.prev = t
+	}
+	l.head = t
+}
+
+func (l *timerList) remove(t *Timer) {
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		l.head = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	t.list, t.prev, t.next = nil, nil, nil
+}
+
+// take removes and returns all the timers.
+func (l *timerList) take() *Timer {
+	t := l.head
+	l.head = nil
+	return t
+}
+
+// NewScheduler creates a Scheduler running tasks in p.
+func NewScheduler(p Pool, config *SchedulerConfig) *Scheduler {
+	s := &Scheduler{
+		pool:  p,
+		tick:  config.Tick,
+		clock: config.Clock,
+		stop:  make(chan struct{}),
+	}
+	if s.tick <= 0 {
+		s.tick = defaultSchedulerTick
+	}
+	if s.clock == nil {
+		s.clock = systemClock{}
+	}
+	s.origin = s.clock.Now()
+	go s.run()
+	return s
+}
+
+// GoAfter runs f in the pool after d.
+func (s *Scheduler) GoAfter(d time.Duration, f func()) *Timer {
+	return s.schedule(s.after(d), 0, f)
+}
+
+// GoAt runs f in the pool at t.
+func (s *Scheduler) GoAt(t time.Time, f func()) *Timer {
+	return s.schedule(t.Sub(s.origin), 0, f)
+}
+
+// GoEvery runs f in the pool every interval, starting after interval.
+// A run is skipped if the previous one is still running or the scheduler falls behind,
+// so that the runs of f never overlap. A run discarded by the pool doesn't stop the next ones.
+// It panics if interval is not positive.
+func (s *Scheduler) GoEvery(interval time.Duration, f func()) *Timer {
+	if interval <= 0 {
+		panic("gopool: non-positive interval for GoEvery")
+	}
+	return s.schedule(s.after(interval), s.ticks(interval), f)
+}
+
+// MissedCount returns the number of runs discarded by the pool, e.g. its queue is full or it's shut down.
+func (s *Scheduler) MissedCount() uint64 {
+	return atomic.LoadUint64(&s.missedCount)
+}
+
+// Stop stops the scheduler, the pending timers are never run.
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// Cancel cancels t, returns false if t is already run or cancelled.
+// A periodic timer may still be running, or about to run, when Cancel returns.
+func (t *Timer) Cancel() bool {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	if t.list == nil {
+		return false
+	}
+	t.list.remove(t)
+	return true
+}
+
+// after returns the time elapsed since origin when d passes from now.
+func (s *Scheduler) after(d time.Duration) time.Duration {
+	e := s.clock.Now().Sub(s.origin)
+	if d > 0 && e+d < e {
+		// overflow
+		return 1<<63 - 1
+	}
+	return e + d
+}
+
+// ticks rounds d up to ticks.
+func (s *Scheduler) ticks(d time.Duration) uint64 {
+	if d <= 0 {
+		return 0
+	}
+	n := uint64(d / s.tick)
+	if d%s.tick != 0 {
+		n++
+	}
+	return n
+}
+
+func (s *Scheduler) schedule(at time.Duration, interval uint64, f func()) *Timer {
+	t := &Timer{s: s, f: f, due: s.ticks(at), interval: interval}
+	s.mu.Lock()
+	if t.due <= s.now {
+		t.due = s.now + 1
+	}
+	s.add(t)
+	s.mu.Unlock()
+	return t
+}
+
+// add puts t into the slot of its due tick, which must not be earlier than now.
+// The slots of the current tick are already expired, except in cascade.
+func (s *Scheduler) add(t *Timer) {
+	due := t.due
+	delta := due - s.now
+	if delta >= wheelSpan {
+		due = s.now + wheelSpan - 1
+		delta = wheelSpan - 1
+	}
+	l := 0
+	for delta >= 1<<(wheelBits*(l+1)) {
+		l++
+	}
+	s.wheel[l][due>>(wheelBits*l)&wheelMask].push(t)
+}
+
+func (s *Scheduler) run() {
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.advance()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// advance expires the timers due by now, and runs them in the pool.
+func (s *Scheduler) advance() {
+	for _, t := range s.expire(uint64(s.clock.Now().Sub(s.origin) / s.tick)) {
+		if t.interval == 0 {
+			s.tryGo(t.f, nil)
+			continue
+		}
+		if atomic.CompareAndSwapInt32(&t.running, 0, 1) {
+			t := t
+			s.tryGo(t.runPeriodic, func() { atomic.StoreInt32(&t.running, 0) })
+		}
+	}
+}
+
+// tryGo runs f in the pool without blocking the scheduler, regardless of the RejectPolicy of the pool.
+// If f is discarded by the pool, e.g. its queue is full, it's counted by MissedCount, and release
+// is called if it's not nil, e.g. to release a periodic timer for its next run.
+// The pools implementing neither TryGoer nor the drop reporting are submitted by Go, which may block.
+func (s *Scheduler) tryGo(f func(), release func()) {
+	miss := func(error) {
+		atomic.AddUint64(&s.missedCount, 1)
+		if release != nil {
+			release()
+		}
+	}
+	if dp, ok := s.pool.(dropReporter); ok {
+		dp.ctxTryGoOrDrop(context.Background(), f, miss)
+	} else if tp, ok := s.pool.(TryGoer); ok {
+		if err := tp.TryGo(f); err != nil {
+			miss(err)
+		}
+	} else {
+		s.pool.Go(f)
+	}
+}
+
+func (t *Timer) runPeriodic() {
+	defer atomic.StoreInt32(&t.running, 0)
+	t.f()
+}
+
+// expire moves the wheel forward to target, and returns the due timers.
+// The periodic timers are added again, skipping the runs due by target.
+func (s *Scheduler) expire(target uint64) (due []*Timer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.now < target {
+		s.now++
+		// cascade the higher levels first, whose timers may be due in the lower levels
+		for l := wheelLevels - 1; l > 0; l-- {
+			if s.now&(1<<(wheelBits*l)-1) != 0 {
+				continue
+			}
+			for t := s.wheel[l][s.now>>(wheelBits*l)&wheelMask].take(); t != nil; {
+				next := t.next
+				s.add(t)
+				t = next
+			}
+		}
+		for t := s.wheel[0][s.now&wheelMask].take(); t != nil; {
+			next := t.next
+			t.list, t.prev, t.next = nil, nil, nil
+			due = append(due, t)
+			t = next
+		}
+	}
+	for _, t := range due {
+		if t.interval == 0 {
+			continue
+		}
+		t.due += t.interval
+		if t.due <= s.now {
+			t.due += ((s.now-t.due)/t.interval + 1) * t.interval
+		}
+		s.add(t)
+	}
+	return due
+}
+
+var (
+	defaultScheduler     *Scheduler
+	defaultSchedulerOnce sync.Once
+)
+
+func getDefaultScheduler() *Scheduler {
+	defaultSchedulerOnce.Do(func() {
+		defaultScheduler = NewScheduler(defaultPool, NewSchedulerConfig())
+	})
+	return defaultScheduler
+}
+
+// GoAfter runs f in the global pool after d.
+func GoAfter(d time.Duration, f func()) *Timer {
+	return getDefaultScheduler().GoAfter(d, f)
+}
+
+// GoAt runs f in the global pool at t.
+func GoAt(t time.Time, f func()) *Timer {
+	return getDefaultScheduler().GoAt(t, f)
+}
+
+// GoEvery runs f in the global pool every interval, it panics if interval is not positive.
+func GoEvery(interval time.Duration, f func()) *Timer {
+	return getDefaultScheduler().GoEvery(interval, f)
+}
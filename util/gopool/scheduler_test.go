@@ -0,0 +1,319 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestScheduler creates a scheduler which is only advanced by the tests.
+func newTestScheduler() (*Scheduler, *fakeClock) {
+	clock := newFakeClock()
+	config := NewSchedulerConfig()
+	config.Tick = time.Millisecond
+	config.Clock = clock
+	s := NewScheduler(NewPool("test", 100, NewConfig()), config)
+	s.Stop()
+	return s, clock
+}
+
+func TestSchedulerWheel(t *testing.T) {
+	s, _ := newTestScheduler()
+	deltas := []uint64{1, 2, 63, 64, 65, 127, 4095, 4096, 4097, 262143, 262144, 300000}
+	for _, d := range deltas {
+		s.schedule(time.Duration(d)*time.Millisecond, 0, func() {})
+	}
+	// starts at an unaligned tick
+	s.expire(100)
+	for _, d := range deltas {
+		s.schedule(time.Duration(100+d)*time.Millisecond, 0, func() {})
+	}
+
+	fired := make(map[uint64]int)
+	for tick := uint64(101); tick <= 300100; tick++ {
+		for _, tm := range s.expire(tick) {
+			if tm.due != tick {
+				t.Error(tm.due, tick)
+			}
+			fired[tick]++
+		}
+	}
+	for _, d := range deltas {
+		if d > 100 {
+			if fired[d] != 1 {
+				t.Error(d, fired[d])
+			}
+		}
+		if fired[100+d] != 1 {
+			t.Error(100+d, fired[100+d])
+		}
+	}
+}
+
+func TestSchedulerBeyondWheel(t *testing.T) {
+	s, _ := newTestScheduler()
+	tm := s.schedule(time.Duration(wheelSpan+10)*time.Millisecond, 0, func() {})
+	// the timer is in the last slot of the wheel, and cascaded again at the end of it.
+	// the wheel is moved forward to the ticks before cascading, since the other slots are empty.
+	const top = wheelBits * (wheelLevels - 1)
+	if tm.list != &s.wheel[wheelLevels-1][wheelMask] {
+		t.Fatal("not in the last slot")
+	}
+	s.now = wheelMask<<top - 1
+	s.expire(wheelMask << top)
+	if tm.list != &s.wheel[wheelLevels-1][0] {
+		t.Fatal("not cascaded")
+	}
+	s.now = wheelSpan - 1
+	if due := s.expire(wheelSpan + 9); len(due) != 0 {
+		t.Error(len(due))
+	}
+	if due := s.expire(wheelSpan + 10); len(due) != 1 || due[0] != tm {
+		t.Error(due)
+	}
+}
+
+func TestSchedulerGoAfter(t *testing.T) {
+	s, clock := newTestScheduler()
+	done := make(chan struct{})
+	s.GoAfter(10*time.Millisecond, func() { close(done) })
+	at := make(chan struct{})
+	s.GoAt(clock.Now().Add(20*time.Millisecond), func() { close(at) })
+
+	clock.Advance(9 * time.Millisecond)
+	s.advance()
+	select {
+	case <-done:
+		t.Error("run early")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(time.Millisecond)
+	s.advance()
+	<-done
+
+	clock.Advance(10 * time.Millisecond)
+	s.advance()
+	<-at
+}
+
+func TestSchedulerGoEvery(t *testing.T) {
+	s, clock := newTestScheduler()
+	runs := make(chan struct{}, 10)
+	tm := s.GoEvery(10*time.Millisecond, func() { runs <- struct{}{} })
+	for i := 0; i < 3; i++ {
+		clock.Advance(10 * time.Millisecond)
+		s.advance()
+		<-runs
+	}
+
+	// the missed runs are skipped
+	clock.Advance(100 * time.Millisecond)
+	s.advance()
+	<-runs
+	if tm.due != 140 {
+		t.Error(tm.due)
+	}
+
+	if !tm.Cancel() {
+		t.Error("not cancelled")
+	}
+	if tm.Cancel() {
+		t.Error("cancelled twice")
+	}
+	clock.Advance(100 * time.Millisecond)
+	s.advance()
+	select {
+	case <-runs:
+		t.Error("run after cancel")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestSchedulerGoEveryRejected(t *testing.T) {
+	config := NewConfig()
+	config.MaxQueueSize = 1
+	config.RejectPolicy = RejectAbort
+	p, release := newBlockedPool(config)
+	queued := make(chan struct{})
+	p.Go(func() { close(queued) })
+	clock := newFakeClock()
+	sc := NewSchedulerConfig()
+	sc.Tick = time.Millisecond
+	sc.Clock = clock
+	s := NewScheduler(p, sc)
+	s.Stop()
+
+	runs := make(chan struct{}, 10)
+	s.GoEvery(10*time.Millisecond, func() { runs <- struct{}{} })
+	// the run is rejected since the queue is full
+	clock.Advance(10 * time.Millisecond)
+	s.advance()
+	if c := p.RejectedCount(); c != 1 {
+		t.Error(c)
+	}
+	if c := s.MissedCount(); c != 1 {
+		t.Error(c)
+	}
+
+	// the timer keeps running after the rejection
+	release()
+	<-queued
+	clock.Advance(10 * time.Millisecond)
+	s.advance()
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Error("not run after the rejection")
+	}
+}
+
+func TestSchedulerFullPool(t *testing.T) {
+	for _, policy := range []RejectPolicy{RejectBlock, RejectCallerRuns} {
+		config := NewConfig()
+		config.MaxQueueSize = 1
+		config.RejectPolicy = policy
+		p, release := newBlockedPool(config)
+		queued := make(chan struct{})
+		p.Go(func() { close(queued) })
+		clock := newFakeClock()
+		sc := NewSchedulerConfig()
+		sc.Tick = time.Millisecond
+		sc.Clock = clock
+		s := NewScheduler(p, sc)
+		s.Stop()
+
+		runs := make(chan struct{}, 10)
+		s.GoAfter(10*time.Millisecond, func() { runs <- struct{}{} })
+		s.GoEvery(10*time.Millisecond, func() { runs <- struct{}{} })
+		// the runs are discarded without blocking the scheduler or running on it
+		clock.Advance(10 * time.Millisecond)
+		advanced := make(chan struct{})
+		go func() {
+			s.advance()
+			close(advanced)
+		}()
+		select {
+		case <-advanced:
+		case <-time.After(time.Second):
+			t.Fatal(policy, "blocked by the full pool")
+		}
+		if c := s.MissedCount(); c != 2 {
+			t.Error(policy, c)
+		}
+		if len(runs) != 0 {
+			t.Error(policy, "run by the scheduler")
+		}
+
+		// the timer keeps running after the miss
+		release()
+		<-queued
+		clock.Advance(10 * time.Millisecond)
+		s.advance()
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Error(policy, "not run after the miss")
+		}
+	}
+}
+
+func TestSchedulerGoEveryOverlap(t *testing.T) {
+	s, clock := newTestScheduler()
+	var runs int32
+	block := make(chan struct{})
+	started := make(chan struct{})
+	tm := s.GoEvery(time.Millisecond, func() {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			close(started)
+			<-block
+		}
+	})
+	defer tm.Cancel()
+	clock.Advance(time.Millisecond)
+	s.advance()
+	<-started
+	// skipped since the first run is still running
+	for i := 0; i < 10; i++ {
+		clock.Advance(time.Millisecond)
+		s.advance()
+	}
+	close(block)
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Error(n)
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	s, clock := newTestScheduler()
+	tm := s.GoAfter(time.Hour, func() { t.Error("run after cancel") })
+	if !tm.Cancel() {
+		t.Error("not cancelled")
+	}
+	clock.Advance(time.Hour)
+	s.advance()
+
+	done := make(chan struct{})
+	tm = s.GoAfter(time.Millisecond, func() { close(done) })
+	clock.Advance(time.Millisecond)
+	s.advance()
+	<-done
+	if tm.Cancel() {
+		t.Error("cancelled after run")
+	}
+}
+
+func TestSchedulerPanic(t *testing.T) {
+	p := NewPool("test", 1, NewConfig())
+	recovered := make(chan interface{}, 1)
+	p.SetPanicHandler(func(ctx context.Context, r interface{}) {
+		recovered <- r
+	})
+	clock := newFakeClock()
+	config := NewSchedulerConfig()
+	config.Clock = clock
+	s := NewScheduler(p, config)
+	s.Stop()
+
+	s.GoAfter(0, testPanicFunc)
+	clock.Advance(config.Tick)
+	s.advance()
+	if r := <-recovered; r != "test" {
+		t.Error(r)
+	}
+}
+
+func TestGoAfter(t *testing.T) {
+	done := make(chan struct{})
+	start := time.Now()
+	GoAfter(20*time.Millisecond, func() { close(done) })
+	<-done
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Error(d)
+	}
+}
+
+func BenchmarkSchedulerGoAfter(b *testing.B) {
+	s := NewScheduler(NewPool("benchmark", 10000, NewConfig()), NewSchedulerConfig())
+	defer s.Stop()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.GoAfter(time.Duration(i%1000)*time.Second, testFunc).Cancel()
+	}
+}
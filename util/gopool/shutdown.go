@@ -0,0 +1,98 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrPoolClosed is returned by TryGo if the pool is shut down.
+var ErrPoolClosed = errors.New("gopool: pool is shut down")
+
+func (p *pool) Shutdown(ctx context.Context) error {
+	p.close()
+	p.checkDrained()
+	select {
+	case <-p.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ShutdownNow returns the queued tasks except the ones submitted by Submit or Group,
+// which are completed with ErrPoolClosed instead.
+// The running tasks are not waited.
+func (p *pool) ShutdownNow() []func() {
+	p.close()
+	var fs []func()
+	for {
+		var t *task
+		if p.tenants != nil {
+			// the tasks throttled by Config.Tenants are popped too
+			p.taskLock.Lock()
+			t = p.popped(p.queue.popOldest())
+			p.taskLock.Unlock()
+		} else {
+			t = p.popTask()
+		}
+		if t == nil {
+			break
+		}
+		if t.drop != nil {
+			t.drop(ErrPoolClosed)
+		} else {
+			fs = append(fs, t.f)
+		}
+		t.Recycle()
+	}
+	p.checkDrained()
+	return fs
+}
+
+// close marks the pool closed, and wakes up the parked workers and blocked submitters.
+func (p *pool) close() {
+	p.taskLock.Lock()
+	defer p.taskLock.Unlock()
+	if atomic.LoadInt32(&p.closed) != 0 {
+		return
+	}
+	atomic.StoreInt32(&p.closed, 1)
+	for p.wakeIdle() {
+	}
+	if p.spaceChan != nil {
+		close(p.spaceChan)
+		p.spaceChan = nil
+	}
+}
+
+// checkDrained closes drained if the pool is closed, and there's no task or worker.
+func (p *pool) checkDrained() {
+	if atomic.LoadInt32(&p.taskCount) != 0 || p.WorkerCount() != 0 {
+		return
+	}
+	p.taskLock.Lock()
+	defer p.taskLock.Unlock()
+	if atomic.LoadInt32(&p.closed) == 0 {
+		return
+	}
+	select {
+	case <-p.drained:
+	default:
+		close(p.drained)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	p, release := newBlockedPool(NewConfig())
+	var n int32
+	for i := 0; i < 10; i++ {
+		p.Go(func() { atomic.AddInt32(&n, 1) })
+	}
+
+	// the queued tasks are waited until ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+	p.Go(func() { t.Error("task is run after shutdown") })
+	if err := p.TryGo(func() {}); err != ErrPoolClosed {
+		t.Error(err)
+	}
+	if c := p.RejectedCount(); c != 2 {
+		t.Error(c)
+	}
+
+	release()
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if n != 10 {
+		t.Error(n)
+	}
+	if c := p.WorkerCount(); c != 0 {
+		t.Error(c)
+	}
+}
+
+func TestShutdownBlocked(t *testing.T) {
+	config := NewConfig()
+	config.MaxQueueSize = 1
+	p, release := newBlockedPool(config)
+	defer release()
+	p.Go(func() {})
+
+	done := make(chan struct{})
+	go func() {
+		p.Go(func() { t.Error("task is run after shutdown") })
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if fs := p.ShutdownNow(); len(fs) != 1 {
+		t.Error(len(fs))
+	}
+	<-done
+}
+
+func TestShutdownNow(t *testing.T) {
+	p, release := newBlockedPool(NewConfig())
+	for i := 0; i < 10; i++ {
+		p.Go(func() {})
+	}
+	f := Submit(p, context.Background(), func(ctx context.Context) (int, error) { return 1, nil })
+
+	if fs := p.ShutdownNow(); len(fs) != 10 {
+		t.Error(len(fs))
+	}
+	if _, err := f.Get(context.Background()); err != ErrPoolClosed {
+		t.Error(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+	release()
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestShutdownIdleWorkers(t *testing.T) {
+	config := NewConfig()
+	config.IdleTimeout = time.Hour
+	config.MinWorkers = 2
+	p := NewPool("test", 100, config).(*pool)
+	done := make(chan struct{})
+	p.Go(func() { close(done) })
+	<-done
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Error(err)
+	}
+	if c := p.WorkerCount(); c != 0 {
+		t.Error(c)
+	}
+}
+
+func TestShutdownParkingWorker(t *testing.T) {
+	config := NewConfig()
+	config.MinWorkers = 1
+	p := NewPool("test", 1, config).(*pool)
+	p.close()
+	// a worker which has decided to park before closing must not be parked after it.
+	w := newWorker().(*worker)
+	w.pool = p
+	if w.park() || len(p.idleWorkers) != 0 {
+		t.Error(len(p.idleWorkers))
+	}
+}
+
+func TestUnregisterPool(t *testing.T) {
+	name := "test_unregister"
+	p := NewPool(name, 1, NewConfig())
+	if err := RegisterPool(p); err != nil {
+		t.Fatal(err)
+	}
+	UnregisterPool(name)
+	if GetPool(name) != nil {
+		t.Error("pool is not unregistered")
+	}
+	if err := RegisterPool(p); err != nil {
+		t.Error(err)
+	}
+	UnregisterPool(name)
+}
@@ -0,0 +1,253 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying tenant, which is used by CtxGo.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant carried by ctx, defaults to "".
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// TenantConfig is the quota of a tenant, see Config.Tenants.
+type TenantConfig struct {
+	// the share of workers of the tenant relative to the other tenants when they're all busy,
+	// i.e. the weight in the weighted fair queueing.
+	// defaults to 1.
+	Weight int32
+	// the max number of running tasks of the tenant, the rest are kept queued.
+	// 0 means unlimited.
+	MaxConcurrency int32
+}
+
+// TenantMetrics is a snapshot of the metrics of a tenant.
+type TenantMetrics struct {
+	// Running is the number of running tasks.
+	Running int32
+	// QueuedTasks is the number of tasks waiting for workers.
+	QueuedTasks int32
+	// Submitted is the total number of tasks queued.
+	Submitted uint64
+	// Completed is the total number of tasks run, including the panicked ones.
+	Completed uint64
+	// Throttled is the total number of times a task of another tenant is run in place of
+	// the tenant's due one, because the tenant reaches MaxConcurrency.
+	Throttled uint64
+	// WaitTime is the histogram of the time from queuing to running of tasks,
+	// it's only recorded if Config.RecordTaskTime is set.
+	WaitTime Histogram
+}
+
+// tenant is the state of a tenant in tenantQueue.
+type tenant struct {
+	// the 64-bit atomic fields are kept first to be aligned on 32-bit platforms.
+	submitted uint64
+	completed uint64
+	throttled uint64
+	waitTime  histogram
+
+	name   string
+	config TenantConfig
+
+	// the following fields are guarded by tenantQueue.mu
+	tasks   priorityLists
+	queued  int32
+	running int32
+	// vtime is the virtual time advanced by 1/Weight per popped task.
+	vtime  float64
+	active bool
+}
+
+// limited reports whether the tenant reaches MaxConcurrency.
+func (tn *tenant) limited() bool {
+	return tn.config.MaxConcurrency > 0 && tn.running >= tn.config.MaxConcurrency
+}
+
+// tenantQueue holds the tasks per tenant, and pops them by weighted fair queueing among the tenants
+// not reaching MaxConcurrency: the active tenant of the least virtual time is popped first,
+// and the tasks of a tenant are popped by priority.
+type tenantQueue struct {
+	mu      sync.Mutex
+	tenants map[string]*tenant
+	// the tenants with queued tasks
+	active []*tenant
+	// vtime is the virtual time of the last popped tenant, a tenant becoming active starts from it,
+	// so that it can't save up its share while it's idle.
+	vtime float64
+
+	configs             map[string]TenantConfig
+	defaultConfig       TenantConfig
+	starvationThreshold int32
+}
+
+func newTenantQueue(config *Config, starvationThreshold int32) *tenantQueue {
+	return &tenantQueue{
+		tenants:             make(map[string]*tenant),
+		configs:             config.Tenants,
+		defaultConfig:       config.DefaultTenant,
+		starvationThreshold: starvationThreshold,
+	}
+}
+
+// get returns the tenant of name, which is created on the first use. It must be called with mu held.
+func (q *tenantQueue) get(name string) *tenant {
+	tn := q.tenants[name]
+	if tn == nil {
+		config, ok := q.configs[name]
+		if !ok {
+			config = q.defaultConfig
+		}
+		if config.Weight <= 0 {
+			config.Weight = 1
+		}
+		tn = &tenant{name: name, config: config}
+		q.tenants[name] = tn
+	}
+	return tn
+}
+
+func (q *tenantQueue) push(t *task) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	tn := q.get(TenantFromContext(t.ctx))
+	t.tenant = tn
+	tn.tasks.push(t)
+	tn.queued++
+	atomic.AddUint64(&tn.submitted, 1)
+	if !tn.active {
+		tn.active = true
+		q.active = append(q.active, tn)
+		if tn.vtime < q.vtime {
+			tn.vtime = q.vtime
+		}
+	}
+}
+
+func (q *tenantQueue) pop() *task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// due is the tenant whose turn it is, pick is the one popped
+	var due, pick *tenant
+	for _, tn := range q.active {
+		if due == nil || tn.vtime < due.vtime {
+			due = tn
+		}
+		if tn.limited() {
+			continue
+		}
+		if pick == nil || tn.vtime < pick.vtime {
+			pick = tn
+		}
+	}
+	if pick == nil {
+		return nil
+	}
+	if due != pick {
+		atomic.AddUint64(&due.throttled, 1)
+	}
+	t := pick.tasks.pop(q.starvationThreshold)
+	pick.running++
+	q.vtime = pick.vtime
+	pick.vtime += 1 / float64(pick.config.Weight)
+	q.dequeued(pick)
+	return t
+}
+
+// popOldest pops the oldest task of the lowest priority of the tenant
+// with the most queued tasks relative to its weight.
+func (q *tenantQueue) popOldest() *task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var pick *tenant
+	for _, tn := range q.active {
+		if pick == nil || int64(tn.queued)*int64(pick.config.Weight) > int64(pick.queued)*int64(tn.config.Weight) {
+			pick = tn
+		}
+	}
+	if pick == nil {
+		return nil
+	}
+	t := pick.tasks.popOldest()
+	q.dequeued(pick)
+	return t
+}
+
+// dequeued is called after a task of tn is popped, it must be called with mu held.
+func (q *tenantQueue) dequeued(tn *tenant) {
+	if tn.queued--; tn.queued > 0 {
+		return
+	}
+	tn.active = false
+	for i, a := range q.active {
+		if a == tn {
+			last := len(q.active) - 1
+			q.active[i] = q.active[last]
+			q.active[last] = nil
+			q.active = q.active[:last]
+			break
+		}
+	}
+}
+
+// ready reports whether there's a task to pop, i.e. the queued tasks are not all throttled.
+func (q *tenantQueue) ready() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, tn := range q.active {
+		if !tn.limited() {
+			return true
+		}
+	}
+	return false
+}
+
+// done is called when a popped task of tn is done, ran is false if it's skipped or discarded.
+func (q *tenantQueue) done(tn *tenant, ran bool) {
+	if ran {
+		atomic.AddUint64(&tn.completed, 1)
+	}
+	q.mu.Lock()
+	tn.running--
+	q.mu.Unlock()
+}
+
+func (q *tenantQueue) metrics() map[string]TenantMetrics {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	m := make(map[string]TenantMetrics, len(q.tenants))
+	for name, tn := range q.tenants {
+		m[name] = TenantMetrics{
+			Running:     tn.running,
+			QueuedTasks: tn.queued,
+			Submitted:   atomic.LoadUint64(&tn.submitted),
+			Completed:   atomic.LoadUint64(&tn.completed),
+			Throttled:   atomic.LoadUint64(&tn.throttled),
+			WaitTime:    tn.waitTime.snapshot(),
+		}
+	}
+	return m
+}
@@ -0,0 +1,218 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTenantTask(tenant string, prio Priority) *task {
+	return &task{ctx: WithTenant(context.Background(), tenant), prio: prio.index()}
+}
+
+func TestTenantQueueWeight(t *testing.T) {
+	config := NewConfig()
+	config.Tenants = map[string]TenantConfig{"a": {Weight: 2}}
+	q := newTenantQueue(config, defaultStarvationThreshold)
+	for i := 0; i < 30; i++ {
+		q.push(newTenantTask("a", PriorityNormal))
+		q.push(newTenantTask("b", PriorityNormal))
+	}
+	popped := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		tk := q.pop()
+		popped[tk.tenant.name]++
+		q.done(tk.tenant, true)
+	}
+	if popped["a"] != 20 || popped["b"] != 10 {
+		t.Error(popped)
+	}
+
+	// a tenant becoming active doesn't take the share it didn't use
+	for i := 0; i < 10; i++ {
+		q.push(newTenantTask("c", PriorityNormal))
+	}
+	popped = make(map[string]int)
+	for i := 0; i < 12; i++ {
+		tk := q.pop()
+		popped[tk.tenant.name]++
+		q.done(tk.tenant, true)
+	}
+	if popped["a"] != 6 || popped["b"] != 3 || popped["c"] != 3 {
+		t.Error(popped)
+	}
+}
+
+func TestTenantQueueMaxConcurrency(t *testing.T) {
+	config := NewConfig()
+	config.Tenants = map[string]TenantConfig{"b": {}}
+	config.DefaultTenant = TenantConfig{MaxConcurrency: 1}
+	q := newTenantQueue(config, defaultStarvationThreshold)
+	q.push(newTenantTask("a", PriorityLow))
+	q.push(newTenantTask("a", PriorityHigh))
+	q.push(newTenantTask("b", PriorityNormal))
+	q.push(newTenantTask("b", PriorityNormal))
+
+	a := q.pop()
+	if a.tenant.name != "a" || a.prio != PriorityHigh.index() {
+		t.Error(a.tenant.name, a.prio)
+	}
+	if b := q.pop(); b.tenant.name != "b" {
+		t.Error(b.tenant.name)
+	}
+	// it's the turn of a, which is throttled
+	if b := q.pop(); b.tenant.name != "b" {
+		t.Error(b.tenant.name)
+	}
+	// a is throttled, but no task is run in place of it
+	if tk := q.pop(); tk != nil {
+		t.Error(tk.tenant.name)
+	}
+	if q.ready() {
+		t.Error("ready")
+	}
+	q.done(a.tenant, true)
+	if !q.ready() {
+		t.Error("not ready")
+	}
+	if tk := q.pop(); tk.tenant.name != "a" || tk.prio != PriorityLow.index() {
+		t.Error(tk.tenant.name, tk.prio)
+	}
+
+	m := q.metrics()
+	if ma := m["a"]; ma.Running != 1 || ma.QueuedTasks != 0 || ma.Submitted != 2 || ma.Completed != 1 || ma.Throttled != 1 {
+		t.Errorf("%+v", ma)
+	}
+}
+
+func TestTenantQueuePopOldest(t *testing.T) {
+	config := NewConfig()
+	config.Tenants = map[string]TenantConfig{"a": {Weight: 4}}
+	q := newTenantQueue(config, defaultStarvationThreshold)
+	for i := 0; i < 4; i++ {
+		q.push(newTenantTask("a", PriorityNormal))
+	}
+	q.push(newTenantTask("b", PriorityNormal))
+	q.push(newTenantTask("b", PriorityNormal))
+	// b has the most queued tasks relative to its weight
+	if tk := q.popOldest(); tk.tenant.name != "b" {
+		t.Error(tk.tenant.name)
+	}
+}
+
+func TestPoolTenants(t *testing.T) {
+	config := NewConfig()
+	config.Tenants = map[string]TenantConfig{"noisy": {MaxConcurrency: 2}}
+	p := NewPool("test", 10, config).(*pool)
+
+	var running, maxRunning int32
+	var mu sync.Mutex
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		p.CtxGoWithTenant(context.Background(), "noisy", func() {
+			defer wg.Done()
+			n := atomic.AddInt32(&running, 1)
+			mu.Lock()
+			if n > maxRunning {
+				maxRunning = n
+			}
+			mu.Unlock()
+			<-block
+			atomic.AddInt32(&running, -1)
+		})
+	}
+
+	for atomic.LoadInt32(&running) != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	// the other tenants are not blocked by the noisy one. The noisy tenant has popped 2 tasks,
+	// so the first quiet task is due before it, and the second one is run in place of it.
+	for i := 0; i < 2; i++ {
+		done := make(chan struct{})
+		p.CtxGo(WithTenant(context.Background(), "quiet"), func() { close(done) })
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("blocked by another tenant")
+		}
+	}
+	if n := p.Metrics().Tenants["noisy"].Throttled; n != 1 {
+		t.Error(n)
+	}
+	if n := atomic.LoadInt32(&running); n != 2 {
+		t.Error(n)
+	}
+	close(block)
+	wg.Wait()
+	if maxRunning != 2 {
+		t.Error(maxRunning)
+	}
+	m := p.Metrics().Tenants
+	if m["noisy"].Submitted != 100 || m["noisy"].Completed != 100 {
+		t.Errorf("%+v", m["noisy"])
+	}
+	if m["quiet"].Completed != 2 {
+		t.Errorf("%+v", m["quiet"])
+	}
+}
+
+func TestPoolTenantsShutdownNow(t *testing.T) {
+	config := NewConfig()
+	config.Tenants = map[string]TenantConfig{}
+	config.DefaultTenant = TenantConfig{MaxConcurrency: 1}
+	p, release := newBlockedPool(config)
+	for i := 0; i < 3; i++ {
+		p.Go(func() {})
+	}
+	if fs := p.ShutdownNow(); len(fs) != 3 {
+		t.Error(len(fs))
+	}
+	release()
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if m := p.Metrics().Tenants[""]; m.Running != 0 || m.QueuedTasks != 0 {
+		t.Errorf("%+v", m)
+	}
+}
+
+func BenchmarkPoolTenants(b *testing.B) {
+	config := NewConfig()
+	config.Tenants = map[string]TenantConfig{}
+	p := NewPool("benchmark", 10000, config)
+	ctxs := make([]context.Context, 16)
+	for i := range ctxs {
+		ctxs[i] = WithTenant(context.Background(), string(rune('a'+i)))
+	}
+	var wg sync.WaitGroup
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Add(benchmarkTimes)
+		for j := 0; j < benchmarkTimes; j++ {
+			p.CtxGo(ctxs[j%len(ctxs)], func() {
+				testFunc()
+				wg.Done()
+			})
+		}
+		wg.Wait()
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"runtime/debug"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/bytedance/gopkg/util/logger"
 )
@@ -31,48 +32,179 @@ func init() {
 
 type worker struct {
 	pool *pool
+	// wake is sent to when the parked worker is popped from pool.idleWorkers.
+	wake chan struct{}
 }
 
 func newWorker() interface{} {
-	return &worker{}
+	return &worker{wake: make(chan struct{}, 1)}
 }
 
 func (w *worker) run() {
 	go func() {
 		for {
-			var t *task
-			w.pool.taskLock.Lock()
-			if w.pool.taskHead != nil {
-				t = w.pool.taskHead
-				w.pool.taskHead = w.pool.taskHead.next
-				atomic.AddInt32(&w.pool.taskCount, -1)
-			}
+			t := w.pool.popTask()
 			if t == nil {
-				// if there's no task to do, exit
-				w.close()
-				w.pool.taskLock.Unlock()
+				// wait for new tasks, or exit
+				if w.idle() {
+					continue
+				}
 				w.Recycle()
 				return
 			}
-			w.pool.taskLock.Unlock()
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						if w.pool.panicHandler != nil {
-							w.pool.panicHandler(t.ctx, r)
-						} else {
-							msg := fmt.Sprintf("GOPOOL: panic in pool: %s: %v: %s", w.pool.name, r, debug.Stack())
-							logger.CtxErrorf(t.ctx, msg)
-						}
-					}
-				}()
-				t.f()
-			}()
+			if w.pool.config.SkipCancelledTasks && w.pool.skipTask(t) {
+				w.pool.doneTask(t, false)
+				t.Recycle()
+				continue
+			}
+			if w.pool.timing {
+				w.pool.started(t)
+			}
+			w.pool.runTask(t)
+			w.pool.doneTask(t, true)
 			t.Recycle()
 		}
 	}()
 }
 
+// idle is called if there's no task to do, it parks the worker if the pool keeps idle workers.
+// It returns false if the worker exits.
+func (w *worker) idle() bool {
+	p := w.pool
+	if !p.keepIdle() || !w.park() {
+		return w.exit()
+	}
+	if p.hasTask() {
+		// a task is queued before the worker is seen as idle
+		w.unpark()
+		return true
+	}
+
+	var timeout <-chan time.Time
+	if p.config.IdleTimeout > 0 {
+		timer := time.NewTimer(p.config.IdleTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-w.wake:
+		return true
+	case <-timeout:
+	}
+	if !w.unpark() {
+		return true
+	}
+	if p.WorkerCount() <= p.config.MinWorkers {
+		return true
+	}
+	return w.exit()
+}
+
+// park adds the worker to the parked workers. It returns false if the pool is closed,
+// since the parked workers have all been woken up by the closing then.
+func (w *worker) park() bool {
+	p := w.pool
+	p.taskLock.Lock()
+	defer p.taskLock.Unlock()
+	if atomic.LoadInt32(&p.closed) != 0 {
+		return false
+	}
+	p.idleWorkers = append(p.idleWorkers, w)
+	atomic.AddInt32(&p.idleCount, 1)
+	return true
+}
+
+// unpark removes the worker from the parked workers, or waits for the wake up
+// if it's popped by a submitter in the meantime, in which case it returns false.
+func (w *worker) unpark() bool {
+	w.pool.taskLock.Lock()
+	removed := w.pool.removeIdle(w)
+	w.pool.taskLock.Unlock()
+	if !removed {
+		<-w.wake
+	}
+	return removed
+}
+
+// exit decreases the worker count, it returns false if the worker exits.
+func (w *worker) exit() bool {
+	w.close()
+	// taskCount is increased before the submitter loads the worker count,
+	// so a task queued in the meantime is seen here if no worker is started for it.
+	// The throttled tasks of tenants are left to the workers running the other tasks of them.
+	if w.pool.hasTask() {
+		w.pool.incWorkerCount()
+		return true
+	}
+	if atomic.LoadInt32(&w.pool.closed) != 0 {
+		w.pool.checkDrained()
+	}
+	return false
+}
+
+// skipTask skips t if its context is done.
+func (p *pool) skipTask(t *task) bool {
+	if t.ctx == nil {
+		return false
+	}
+	err := t.ctx.Err()
+	if err == nil {
+		return false
+	}
+	p.metrics.skipped.Add(1)
+	if t.drop != nil {
+		t.drop(err)
+	}
+	if p.config.SkipHandler != nil {
+		p.config.SkipHandler(t.ctx, err)
+	}
+	return true
+}
+
+// started records the wait time of t which is about to run.
+func (p *pool) started(t *task) {
+	now := p.clock.Now()
+	wait := now.Sub(t.queuedAt)
+	if p.config.RecordTaskTime {
+		p.metrics.waitTime.observe(wait)
+		if t.tenant != nil {
+			t.tenant.waitTime.observe(wait)
+		}
+	}
+	if p.limiter != nil && p.limiter.onStart(now, wait, atomic.LoadInt32(&p.cap)) {
+		p.scaleUp()
+	}
+}
+
+// runTask runs t and recovers the panic.
+func (p *pool) runTask(t *task) {
+	var start time.Time
+	if p.config.RecordTaskTime {
+		start = p.clock.Now()
+	}
+	defer func() {
+		if p.config.RecordTaskTime {
+			p.metrics.execTime.observe(p.clock.Now().Sub(start))
+		}
+		if p.limiter != nil {
+			p.limiter.onDone()
+		}
+		r := recover()
+		if r == nil {
+			p.metrics.completed.Add(1)
+			return
+		}
+		p.metrics.panicked.Add(1)
+		if p.panicHandler != nil {
+			p.panicHandler(t.ctx, r)
+		} else {
+			msg := fmt.Sprintf("GOPOOL: panic in pool: %s: %v: %s", p.name, r, debug.Stack())
+			logger.CtxErrorf(t.ctx, msg)
+		}
+	}()
+	t.f()
+}
+
 func (w *worker) close() {
 	w.pool.decWorkerCount()
 }
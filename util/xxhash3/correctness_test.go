@@ -214,3 +214,30 @@ func TestLen128_1024_1048576_SSE2(t *testing.T) {
 		}
 	}
 }
+
+// TestLengthKnownAnswers checks the lengths whose products with the primes overflow 32 bits,
+// so that the hashes are the same on 32-bit platforms, e.g. GOARCH=386.
+func TestLengthKnownAnswers(t *testing.T) {
+	avx2, sse2 = false, false
+	cases := []struct {
+		length  int
+		hash    uint64
+		hash128 [2]uint64
+	}{
+		{100, 0x8c97158042fbf926, [2]uint64{0x7f5a1f03462e52b4, 0xd61d8dbff22d515f}},
+		{200, 0x12fdb864685f344d, [2]uint64{0x8d8629a1aef9ef90, 0x60ea018811f9a437}},
+		{1000, 0x989765d0ea7a5ecd, [2]uint64{0xf534f51e82a81d29, 0x989765d0ea7a5ecd}},
+	}
+	for _, c := range cases {
+		input := make([]byte, c.length)
+		for i := range input {
+			input[i] = byte(i*31 + 7)
+		}
+		if h := Hash(input); h != c.hash {
+			t.Errorf("length %d: %#x", c.length, h)
+		}
+		if h := Hash128(input); h != c.hash128 {
+			t.Errorf("length %d: %#x", c.length, h)
+		}
+	}
+}